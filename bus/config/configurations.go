@@ -0,0 +1,209 @@
+/*
+Package config defines the supported configuration options for event bus.
+
+Example Configuration file (config.yaml)
+
+	bus.kafka.version: 2.1.0
+	bus.producer:
+		capacity:
+			initial: 3
+			maximum: 10
+		flush:
+			frequency: 500ms
+			timeout: 10s
+		buffer.size: 256
+	bus.consumer:
+		group: my-service
+		topics: events,logs
+		refresh.frequency: 1m
+		start: oldest
+		recovery:
+			backoff:
+				initial: 1s
+				maximum: 1m
+			offset.reset: oldest
+		retry:
+			attempts: 3
+			backoff:
+				initial: 100ms
+				maximum: 10s
+		handler:
+			timeout: 30s
+			abandon: false
+		retry.topics: my-service-retry-10s=10s,my-service-retry-1m=1m,my-service-retry-10m=10m
+		deadletter.topic: my-service-dlq
+		dedup:
+			size: 10000
+			ttl: 1h
+		workers: 8
+		queue.size: 100
+		shutdown.timeout: 30s
+		delivery: at-least-once
+		commit.interval: 1s
+		lag.interval: 1m
+		batch:
+			size: 100
+			wait: 1s
+		backpressure:
+			high: 500
+			low: 100
+*/
+package config
+
+import (
+	"github.com/spf13/viper"
+)
+
+// all configuration keys.
+const (
+	// Environment Variable: "BUS_HOSTS".
+	BusHosts = "bus.hosts"
+	// Environment Variable: "EVENT_TOPIC".
+	BusTopicEvent = "bus.topic.event"
+	// Environment Variable: "LOGS_TOPIC".
+	BusTopicLogs = "bus.topic.logs"
+	// Environment Variable: "BUS_KAFKA_VERSION"		Default: 1.0.0.
+	// Kafka protocol version; 0.11.0 or later, as message headers are required.
+	BusKafkaVersion = "bus.kafka.version"
+
+	// Environment Variable: "BUS_PRODUCER_INIT_CAP"		Default: 3.
+	ProducerInitCap = "bus.producer.capacity.initial"
+	// Environment Variable: "BUS_PRODUCER_MAX_CAP"			Default: 10.
+	ProducerMaxCap = "bus.producer.capacity.maximum"
+	// Default: 10.
+	ProducerMaxRetry = "bus.producer.retry.maximum"
+	// Default: 500ms.
+	ProducerFlushFrequency = "bus.producer.flush.frequency"
+	// Default: 10s.
+	// How long a closing async producer waits for pending messages to be sent.
+	ProducerFlushTimeout = "bus.producer.flush.timeout"
+	// Default: 256.
+	// Number of messages an async producer holds until they are acknowledged.
+	ProducerBufferSize = "bus.producer.buffer.size"
+
+	// Environment Variable: "BUS_CONSUMER_GROUP".
+	ConsumerGroupID = "bus.consumer.group"
+	// Environment Variable: "BUS_CONSUMER_TOPICS".
+	// Comma separated list of topics; defaults to the event topic.
+	ConsumerTopics = "bus.consumer.topics"
+	// Environment Variable: "BUS_CONSUMER_TOPIC_PATTERN".
+	ConsumerTopicPattern = "bus.consumer.topic.pattern"
+	// Default: 1m.
+	ConsumerRefreshFrequency = "bus.consumer.refresh.frequency"
+	// Environment Variable: "BUS_CONSUMER_START"		Default: newest.
+	// One of "newest", "oldest" or an RFC3339 timestamp. Only applies to the
+	// partitions without an offset committed to the consumer group.
+	ConsumerStart = "bus.consumer.start"
+	// Default: 1s.
+	ConsumerRecoveryInitialBackoff = "bus.consumer.recovery.backoff.initial"
+	// Default: 1m.
+	ConsumerRecoveryMaxBackoff = "bus.consumer.recovery.backoff.maximum"
+	// Environment Variable: "BUS_CONSUMER_OFFSET_RESET"	Default: oldest.
+	// One of "oldest", "newest" or "fail".
+	ConsumerOffsetReset = "bus.consumer.recovery.offset.reset"
+	// Default: 1.
+	ConsumerRetryMaxAttempts = "bus.consumer.retry.attempts"
+	// Default: 100ms.
+	ConsumerRetryInitialBackoff = "bus.consumer.retry.backoff.initial"
+	// Default: 10s.
+	ConsumerRetryMaxBackoff = "bus.consumer.retry.backoff.maximum"
+	// Environment Variable: "BUS_CONSUMER_HANDLER_TIMEOUT"	Default: 0 (no timeout).
+	ConsumerHandlerTimeout = "bus.consumer.handler.timeout"
+	// Default: false.
+	// Whether a handler exceeding its timeout is abandoned and the message failed.
+	ConsumerHandlerAbandon = "bus.consumer.handler.abandon"
+	// Environment Variable: "BUS_CONSUMER_RETRY_TOPICS".
+	// Comma separated list of topic=delay pairs, in the order they are used.
+	ConsumerRetryTopics = "bus.consumer.retry.topics"
+	// Environment Variable: "BUS_DEADLETTER_TOPIC".
+	ConsumerDeadLetterTopic = "bus.consumer.deadletter.topic"
+	// Default: 0 (disabled).
+	// Number of message IDs kept in memory to skip duplicate messages.
+	ConsumerDedupSize = "bus.consumer.dedup.size"
+	// Default: 1h.
+	ConsumerDedupTTL = "bus.consumer.dedup.ttl"
+	// Environment Variable: "BUS_CONSUMER_WORKERS"		Default: 1.
+	ConsumerWorkers = "bus.consumer.workers"
+	// Default: 100.
+	ConsumerQueueSize = "bus.consumer.queue.size"
+	// Environment Variable: "BUS_CONSUMER_SHUTDOWN_TIMEOUT"	Default: 30s.
+	ConsumerShutdownTimeout = "bus.consumer.shutdown.timeout"
+	// Environment Variable: "BUS_CONSUMER_DELIVERY"		Default: at-least-once.
+	// One of "at-least-once" or "at-most-once".
+	ConsumerDelivery = "bus.consumer.delivery"
+	// Default: 1s.
+	ConsumerCommitInterval = "bus.consumer.commit.interval"
+	// Default: 1m.
+	ConsumerLagInterval = "bus.consumer.lag.interval"
+	// Default: 100.
+	ConsumerBatchSize = "bus.consumer.batch.size"
+	// Default: 1s.
+	ConsumerBatchWait = "bus.consumer.batch.wait"
+	// Default: 0 (disabled).
+	ConsumerBackpressureHigh = "bus.consumer.backpressure.high"
+	// Default: 0.
+	ConsumerBackpressureLow = "bus.consumer.backpressure.low"
+
+	// Environment Variable: "KAFKA_CLIENT_CERT".
+	KafkaClientCertLocation = "kafka.certs.client.certificate.location"
+	// Environment Variable: "KAFKA_CLIENT_KEY".
+	KafkaClientKeyLocation = "kafka.certs.client.key.location"
+	// Environment Variable: "KAFKA_CACERT".
+	KafkaCACertLocation = "kafka.certs.ca.certificate.location"
+)
+
+func init() {
+	viper.SetDefault(BusKafkaVersion, "1.0.0")
+	viper.SetDefault(ProducerInitCap, 3)
+	viper.SetDefault(ProducerMaxCap, 10)
+	viper.SetDefault(ProducerMaxRetry, 10)
+	viper.SetDefault(ProducerFlushFrequency, "500ms")
+	viper.SetDefault(ProducerFlushTimeout, "10s")
+	viper.SetDefault(ProducerBufferSize, 256)
+	viper.SetDefault(ConsumerRefreshFrequency, "1m")
+	viper.SetDefault(ConsumerStart, "newest")
+	viper.SetDefault(ConsumerRecoveryInitialBackoff, "1s")
+	viper.SetDefault(ConsumerRecoveryMaxBackoff, "1m")
+	viper.SetDefault(ConsumerOffsetReset, "oldest")
+	viper.SetDefault(ConsumerRetryMaxAttempts, 1)
+	viper.SetDefault(ConsumerRetryInitialBackoff, "100ms")
+	viper.SetDefault(ConsumerRetryMaxBackoff, "10s")
+	viper.SetDefault(ConsumerHandlerTimeout, "0s")
+	viper.SetDefault(ConsumerHandlerAbandon, false)
+	viper.SetDefault(ConsumerDedupSize, 0)
+	viper.SetDefault(ConsumerDedupTTL, "1h")
+	viper.SetDefault(ConsumerWorkers, 1)
+	viper.SetDefault(ConsumerQueueSize, 100)
+	viper.SetDefault(ConsumerShutdownTimeout, "30s")
+	viper.SetDefault(ConsumerDelivery, "at-least-once")
+	viper.SetDefault(ConsumerCommitInterval, "1s")
+	viper.SetDefault(ConsumerLagInterval, "1m")
+	viper.SetDefault(ConsumerBatchSize, 100)
+	viper.SetDefault(ConsumerBatchWait, "1s")
+	viper.SetDefault(ConsumerBackpressureHigh, 0)
+	viper.SetDefault(ConsumerBackpressureLow, 0)
+
+	_ = viper.BindEnv(BusHosts, "BUS_HOSTS")
+	_ = viper.BindEnv(BusTopicEvent, "EVENT_TOPIC")
+	_ = viper.BindEnv(BusTopicLogs, "LOGS_TOPIC")
+	_ = viper.BindEnv(BusKafkaVersion, "BUS_KAFKA_VERSION")
+
+	_ = viper.BindEnv(ProducerInitCap, "BUS_PRODUCER_INIT_CAP")
+	_ = viper.BindEnv(ProducerMaxCap, "BUS_PRODUCER_MAX_CAP")
+
+	_ = viper.BindEnv(ConsumerGroupID, "BUS_CONSUMER_GROUP")
+	_ = viper.BindEnv(ConsumerTopics, "BUS_CONSUMER_TOPICS")
+	_ = viper.BindEnv(ConsumerTopicPattern, "BUS_CONSUMER_TOPIC_PATTERN")
+	_ = viper.BindEnv(ConsumerStart, "BUS_CONSUMER_START")
+	_ = viper.BindEnv(ConsumerOffsetReset, "BUS_CONSUMER_OFFSET_RESET")
+	_ = viper.BindEnv(ConsumerHandlerTimeout, "BUS_CONSUMER_HANDLER_TIMEOUT")
+	_ = viper.BindEnv(ConsumerRetryTopics, "BUS_CONSUMER_RETRY_TOPICS")
+	_ = viper.BindEnv(ConsumerDeadLetterTopic, "BUS_DEADLETTER_TOPIC")
+	_ = viper.BindEnv(ConsumerWorkers, "BUS_CONSUMER_WORKERS")
+	_ = viper.BindEnv(ConsumerShutdownTimeout, "BUS_CONSUMER_SHUTDOWN_TIMEOUT")
+	_ = viper.BindEnv(ConsumerDelivery, "BUS_CONSUMER_DELIVERY")
+
+	_ = viper.BindEnv(KafkaClientCertLocation, "KAFKA_CLIENT_CERT")
+	_ = viper.BindEnv(KafkaClientKeyLocation, "KAFKA_CLIENT_KEY")
+	_ = viper.BindEnv(KafkaCACertLocation, "KAFKA_CACERT")
+}
@@ -0,0 +1,320 @@
+package bus
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"gitscm.cisco.com/mcmp/bus/kafka"
+)
+
+// Handler represents a generic function that accepts a message key
+// and byte array containing the received message, and handles the message.
+type Handler = kafka.Handler
+
+// MessageHandler represents a function that handles a consumed Message and
+// reports whether handling failed so the message can be retried.
+type MessageHandler = kafka.MessageHandler
+
+// Message is a message consumed from the bus, along with its topic, partition,
+// offset, timestamp and headers.
+type Message = kafka.Message
+
+// Middleware wraps a MessageHandler to add behavior around the handling of
+// each message.
+type Middleware = kafka.Middleware
+
+// BatchMiddleware wraps a BatchHandler to add behavior around the handling of
+// each batch.
+type BatchMiddleware = kafka.BatchMiddleware
+
+// MetricsRecorder records the outcome of handling each message.
+type MetricsRecorder = kafka.MetricsRecorder
+
+// BatchHandler represents a function that handles a batch of consumed messages.
+// Returning a BatchError reports only the listed messages as failed.
+type BatchHandler = kafka.BatchHandler
+
+// BatchError reports the messages of a batch that failed.
+type BatchError = kafka.BatchError
+
+// BatchPolicy defines how messages are grouped into batches.
+type BatchPolicy = kafka.BatchPolicy
+
+// Header is a key/value pair attached to a message.
+type Header = kafka.Header
+
+// DeliveryMode defines when the offset of a message is committed.
+type DeliveryMode = kafka.DeliveryMode
+
+const (
+	// AtLeastOnce commits the offset of a message once it was handled or routed
+	// to a retry or the dead-letter topic; a message that failed with nowhere to
+	// route it, or whose handling was interrupted, is redelivered, so handlers
+	// should be idempotent.
+	AtLeastOnce = kafka.AtLeastOnce
+	// AtMostOnce commits the offset of a message when it is received, before it
+	// is handled; intended for fire-and-forget events where losing a message
+	// is preferable to handling it twice.
+	AtMostOnce = kafka.AtMostOnce
+)
+
+// ErrorHandler represents a function that is notified of errors encountered
+// by a Consumer while fetching messages.
+type ErrorHandler = kafka.ErrorHandler
+
+// ConsumerError is an error encountered while consuming a partition of a topic.
+type ConsumerError = kafka.ConsumerError
+
+// RetryPolicy defines how a message is retried when the MessageHandler fails.
+type RetryPolicy = kafka.RetryPolicy
+
+// RecoveryPolicy defines how a Consumer recovers a partition whose stream stopped.
+type RecoveryPolicy = kafka.RecoveryPolicy
+
+// OffsetReset defines what a Consumer does when the offset of a partition is out of range.
+type OffsetReset = kafka.OffsetReset
+
+const (
+	// ResetOldest reads the partition from the oldest message retained.
+	ResetOldest = kafka.ResetOldest
+	// ResetNewest reads the partition from the next message published.
+	ResetNewest = kafka.ResetNewest
+	// ResetFail stops reading the partition and reports the error.
+	ResetFail = kafka.ResetFail
+)
+
+// HandlerTimeout defines the time budget of a handler for each attempt.
+type HandlerTimeout = kafka.HandlerTimeout
+
+// TopicPartition identifies a partition of a topic.
+type TopicPartition = kafka.TopicPartition
+
+// Backpressure defines when a Consumer automatically pauses reading messages
+// based on the number of messages in flight.
+type Backpressure = kafka.Backpressure
+
+// PartitionLag describes how far behind a Consumer is on a partition.
+type PartitionLag = kafka.PartitionLag
+
+// DedupStore records the IDs of handled messages so duplicates are skipped.
+type DedupStore = kafka.DedupStore
+
+// DedupKeyFunc returns the ID used to detect duplicates of a message.
+type DedupKeyFunc = kafka.DedupKeyFunc
+
+// Deduplication defines how a Consumer detects duplicate messages.
+type Deduplication = kafka.Deduplication
+
+// HeaderMessageID contains the ID used by default to detect duplicate messages.
+const HeaderMessageID = kafka.HeaderMessageID
+
+// MemoryDedupStore is a DedupStore that keeps the most recently handled message
+// IDs in memory.
+type MemoryDedupStore = kafka.MemoryDedupStore
+
+// NewMemoryDedupStore creates a MemoryDedupStore holding up to capacity message
+// IDs, each expiring after the ttl unless it is zero.
+func NewMemoryDedupStore(capacity int, ttl time.Duration) *MemoryDedupStore {
+	return kafka.NewMemoryDedupStore(capacity, ttl)
+}
+
+// Headers carrying the request metadata of the publishing context, as set with
+// the ctxutil package.
+const (
+	HeaderRequestID      = kafka.HeaderRequestID
+	HeaderTenantID       = kafka.HeaderTenantID
+	HeaderAccountID      = kafka.HeaderAccountID
+	HeaderServiceGroupID = kafka.HeaderServiceGroupID
+	HeaderEnterpriseID   = kafka.HeaderEnterpriseID
+	HeaderPrincipal      = kafka.HeaderPrincipal
+	HeaderClientID       = kafka.HeaderClientID
+)
+
+// MessageContext returns a copy of the context carrying the request metadata
+// found in the headers of the message.
+func MessageContext(ctx context.Context, msg *Message) context.Context {
+	return kafka.MessageContext(ctx, msg)
+}
+
+// SubscribeAll is the event pattern that subscribes to every message key.
+const SubscribeAll = kafka.SubscribeAll
+
+// RetryTier is a topic holding failed messages until they are redelivered.
+type RetryTier = kafka.RetryTier
+
+// Headers added to a message routed to a retry topic.
+const (
+	HeaderRetryAttempt   = kafka.HeaderRetryAttempt
+	HeaderRetryDue       = kafka.HeaderRetryDue
+	HeaderRetryError     = kafka.HeaderRetryError
+	HeaderRetryTopic     = kafka.HeaderRetryTopic
+	HeaderRetryPartition = kafka.HeaderRetryPartition
+	HeaderRetryOffset    = kafka.HeaderRetryOffset
+)
+
+// Headers added to a message routed to the dead-letter topic.
+const (
+	HeaderDeadLetterError     = kafka.HeaderDeadLetterError
+	HeaderDeadLetterAttempts  = kafka.HeaderDeadLetterAttempts
+	HeaderDeadLetterTopic     = kafka.HeaderDeadLetterTopic
+	HeaderDeadLetterPartition = kafka.HeaderDeadLetterPartition
+	HeaderDeadLetterOffset    = kafka.HeaderDeadLetterOffset
+	HeaderDeadLetterTimestamp = kafka.HeaderDeadLetterTimestamp
+)
+
+// Consumer defines a minimal interface for an Message Bus Consumer.
+//
+// The Consumers created by this package also implement Runner, Subscriber,
+// Pauser, LagReporter and HandlerTimeoutCounter, which callers may assert.
+type Consumer interface {
+	// Start will start listening for messages and call the provided handler
+	// for any event that was subcribed. The channel is used to stop listening
+	// for messages.
+	Start(stop <-chan bool)
+	// Close closes any resources in use.
+	Close()
+}
+
+// Runner is implemented by a Consumer that can be run until a context is cancelled.
+type Runner interface {
+	// Run listens for messages and calls the provided handler for any event
+	// that was subscribed until the context is cancelled. Once cancelled, it
+	// stops reading messages and waits up to the shutdown timeout for the
+	// messages being handled to complete.
+	Run(ctx context.Context) error
+}
+
+// Subscriber is implemented by a Consumer whose subscriptions can be changed
+// while it is running.
+type Subscriber interface {
+	// Subscribe adds events to the subscriptions. An event is either a message
+	// key or a glob pattern such as "vm.*"; SubscribeAll subscribes to every key.
+	Subscribe(events ...string) error
+	// Unsubscribe removes events, given as they were subscribed, from the subscriptions.
+	Unsubscribe(events ...string)
+}
+
+// Pauser is implemented by a Consumer that can pause reading partitions.
+type Pauser interface {
+	// Pause stops reading messages from the partitions, or from every partition
+	// when none is given. Messages already read are still handled.
+	Pause(partitions ...TopicPartition)
+	// Resume resumes reading messages from the partitions, or from every
+	// partition when none is given. Resuming partitions while every partition
+	// is paused resumes only them.
+	Resume(partitions ...TopicPartition)
+}
+
+// LagReporter is implemented by a Consumer that reports its lag.
+type LagReporter interface {
+	// Lag returns the current offset, high-water mark and lag of each partition
+	// being read.
+	Lag() []PartitionLag
+}
+
+// HandlerTimeoutCounter is implemented by a Consumer that counts the handlers
+// exceeding the handler timeout.
+type HandlerTimeoutCounter interface {
+	// HandlerTimeouts returns the number of handlers that exceeded the handler timeout.
+	HandlerTimeouts() int64
+}
+
+var (
+	// ErrConsumerClosed is returned by Run when the Consumer was closed.
+	ErrConsumerClosed = kafka.ErrConsumerClosed
+	// ErrShutdownTimeout is returned by Run when the messages being handled did
+	// not complete before the shutdown timeout expired.
+	ErrShutdownTimeout = kafka.ErrShutdownTimeout
+	// ErrHandlerPanic is wrapped by the error reported for a message whose
+	// handler panicked, when the Recover or RecoverBatch middleware is used.
+	ErrHandlerPanic = kafka.ErrHandlerPanic
+	// ErrHandlerTimeout is wrapped by the error reported for a message whose
+	// handler was abandoned after exceeding its timeout.
+	ErrHandlerTimeout = kafka.ErrHandlerTimeout
+)
+
+// NewConsumer creates and configures a Consumer. When a consumer group is
+// configured the Consumer joins the group and only receives messages from the
+// partitions assigned to it; otherwise a standalone Consumer is created.
+// Events are message keys or glob patterns such as "vm.*".
+func NewConsumer(opts Options, h Handler, events ...string) (Consumer, error) {
+	if opts.Consumer.GroupID != "" {
+		return kafka.NewGroupConsumer(opts.Options, h, events...)
+	}
+
+	return kafka.NewConsumer(opts.Options, h, events...)
+}
+
+// NewMessageConsumer creates and configures a Consumer that invokes a
+// MessageHandler. Failed messages are retried according to the Retry policy
+// of the Consumer options and, once every attempt failed, routed to the
+// RetryTiers to be redelivered after a delay, then to the DeadLetterTopic,
+// when configured.
+func NewMessageConsumer(opts Options, h MessageHandler, events ...string) (Consumer, error) {
+	if opts.Consumer.GroupID != "" {
+		return kafka.NewGroupMessageConsumer(opts.Options, h, events...)
+	}
+
+	return kafka.NewMessageConsumer(opts.Options, h, events...)
+}
+
+// NewBatchConsumer creates and configures a Consumer that invokes a BatchHandler
+// with up to Batch.MaxSize messages, or the messages received within
+// Batch.MaxWait. The offsets of a batch are committed once it was handled;
+// failed messages are retried and dead-lettered like with NewMessageConsumer.
+func NewBatchConsumer(opts Options, h BatchHandler, events ...string) (Consumer, error) {
+	if opts.Consumer.GroupID != "" {
+		return kafka.NewGroupBatchConsumer(opts.Options, h, events...)
+	}
+
+	return kafka.NewBatchConsumer(opts.Options, h, events...)
+}
+
+// AdaptHandler converts a Handler into a MessageHandler.
+func AdaptHandler(h Handler) MessageHandler {
+	return kafka.AdaptHandler(h)
+}
+
+// Chain wraps the handler with the middlewares; the first middleware is the outermost.
+func Chain(h MessageHandler, middlewares ...Middleware) MessageHandler {
+	return kafka.Chain(h, middlewares...)
+}
+
+// ChainBatch wraps the batch handler with the middlewares; the first middleware
+// is the outermost.
+func ChainBatch(h BatchHandler, middlewares ...BatchMiddleware) BatchHandler {
+	return kafka.ChainBatch(h, middlewares...)
+}
+
+// Recover returns a Middleware that recovers from a panic in the handler, logs
+// it with the stack trace and reports the message as failed. It is included in
+// the DefaultOptions.
+func Recover(log logrus.FieldLogger) Middleware {
+	return kafka.Recover(log)
+}
+
+// RecoverBatch returns a BatchMiddleware that recovers from a panic in the batch
+// handler, logs it with the stack trace and reports the batch as failed. It is
+// included in the DefaultOptions.
+func RecoverBatch(log logrus.FieldLogger) BatchMiddleware {
+	return kafka.RecoverBatch(log)
+}
+
+// Logging returns a Middleware that logs each message handled along with the outcome.
+func Logging(log logrus.FieldLogger) Middleware {
+	return kafka.Logging(log)
+}
+
+// Timing returns a Middleware that logs how long each message took to handle,
+// as a warning when it took longer than the slow threshold.
+func Timing(log logrus.FieldLogger, slow time.Duration) Middleware {
+	return kafka.Timing(log, slow)
+}
+
+// Metrics returns a Middleware that records the duration and outcome of each
+// message with the MetricsRecorder.
+func Metrics(recorder MetricsRecorder) Middleware {
+	return kafka.Metrics(recorder)
+}
@@ -0,0 +1,25 @@
+package bus
+
+import (
+	"testing"
+
+	"gitscm.cisco.com/mcmp/bus/kafka"
+)
+
+// consumerCapabilities lists every interface the Consumers of this package implement.
+type consumerCapabilities interface {
+	Consumer
+	Runner
+	Subscriber
+	Pauser
+	LagReporter
+	HandlerTimeoutCounter
+}
+
+func TestConsumerCapabilities(t *testing.T) {
+	for _, c := range []Consumer{&kafka.Consumer{}, &kafka.GroupConsumer{}} {
+		if _, ok := c.(consumerCapabilities); !ok {
+			t.Errorf("%T does not implement every consumer capability", c)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+/*
+Package bus defines an event bus interface.
+
+Current implementations provided
+
+	- kafka
+*/
+package bus
@@ -0,0 +1,286 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"gitscm.cisco.com/mcmp/bus/config"
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+const (
+	defaultAsyncBufferSize   = 256
+	defaultAsyncFlushTimeout = 10 * time.Second
+)
+
+// NewAsyncProducer creates an AsyncProducer using the provided options. The
+// caller drains its Errors; NewAsyncPublisher reports the outcome of each
+// message instead.
+func NewAsyncProducer(opts Options) (sarama.AsyncProducer, error) {
+	if len(opts.Hosts) == 0 || opts.Hosts[0] == "" {
+		return nil, errors.ConfigurationError("no host(s) provided")
+	}
+
+	cfg, err := newAsyncConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return sarama.NewAsyncProducer(opts.Hosts, cfg)
+}
+
+func newAsyncConfig(opts Options) (*sarama.Config, error) {
+	cfg := sarama.NewConfig()
+	cfg.Version = opts.kafkaVersion()
+	cfg.Producer.RequiredAcks = sarama.WaitForLocal
+	cfg.Producer.Compression = sarama.CompressionSnappy
+	cfg.Producer.Flush.Frequency = viper.GetDuration(config.ProducerFlushFrequency)
+
+	tlsConfig, err := LoadClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil {
+		cfg.Net.TLS.Config = tlsConfig
+		cfg.Net.TLS.Enable = true
+	}
+
+	return cfg, nil
+}
+
+// DeliveryCallback is invoked once a message published with PublishAsync was
+// acknowledged, with the Receipt describing where it was written, or failed,
+// with the error.
+type DeliveryCallback func(Receipt, error)
+
+// AsyncPublisher publishes messages in the background, batching them with the
+// messages published concurrently. It holds up to BufferSize messages until
+// they are acknowledged.
+type AsyncPublisher struct {
+	producer     sarama.AsyncProducer
+	topic        string
+	log          logrus.FieldLogger
+	flushTimeout time.Duration
+	// slots holds a value for each message not yet acknowledged.
+	slots chan struct{}
+	// closing is closed once Close was called, to release the publishers
+	// waiting for a slot.
+	closing chan struct{}
+	// mu guards closed, so no message is sent once the input is closed.
+	mu     sync.RWMutex
+	closed bool
+	// pending holds the callback of each message not yet acknowledged.
+	pendingMu sync.Mutex
+	pending   map[*sarama.ProducerMessage]DeliveryCallback
+	// callbackMu is held while a callback is invoked, so callbacks are invoked
+	// one at a time whether reported by drain or by Close.
+	callbackMu sync.Mutex
+	// drained is closed once every message was acknowledged after Close.
+	drained chan struct{}
+}
+
+// NewAsyncPublisher creates and configures a new AsyncPublisher.
+func NewAsyncPublisher(opts Options) (*AsyncPublisher, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	// consumer topics are not used by the AsyncPublisher
+	if opts.Topic == "" {
+		return nil, errors.ConfigurationError("no topic provided")
+	}
+
+	size := opts.Producer.BufferSize
+	if size <= 0 {
+		size = defaultAsyncBufferSize
+	}
+
+	flushTimeout := opts.Producer.FlushTimeout
+	if flushTimeout <= 0 {
+		flushTimeout = defaultAsyncFlushTimeout
+	}
+
+	cfg, err := newAsyncConfig(opts)
+	if err != nil {
+		opts.Logger.Errorf("error in loading client certificate: %v", err)
+
+		return nil, err
+	}
+
+	cfg.ChannelBufferSize = size
+	cfg.Producer.Return.Successes = true
+
+	producer, err := sarama.NewAsyncProducer(opts.Hosts, cfg)
+	if err != nil {
+		opts.Logger.Errorf("error while creating a new async producer: %v", err)
+
+		return nil, err
+	}
+
+	p := &AsyncPublisher{
+		producer:     producer,
+		topic:        opts.Topic,
+		log:          opts.Logger,
+		flushTimeout: flushTimeout,
+		slots:        make(chan struct{}, size),
+		closing:      make(chan struct{}),
+		pending:      make(map[*sarama.ProducerMessage]DeliveryCallback),
+		drained:      make(chan struct{}),
+	}
+
+	go p.drain()
+
+	return p, nil
+}
+
+// PublishAsync queues a message to be written on bus, along with the request
+// metadata of the context as message headers, and returns without waiting for
+// it to be acknowledged. The callback, when not nil, is invoked once the
+// message was acknowledged or failed; callbacks are invoked one at a time and
+// should not block. PublishAsync blocks while the buffer is full, until the
+// context is done.
+func (p *AsyncPublisher) PublishAsync(ctx context.Context, key string, msg []byte, done DeliveryCallback) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-p.closing:
+		return ErrProducerClosed
+	case <-ctx.Done():
+		return abortedError{cause: ctx.Err()}
+	}
+
+	pmsg := newProducerMessage(ctx, p.topic, Record{Key: key, Value: msg})
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		<-p.slots
+
+		return ErrProducerClosed
+	}
+
+	p.pendingMu.Lock()
+	p.pending[pmsg] = done
+	p.pendingMu.Unlock()
+
+	p.producer.Input() <- pmsg
+
+	return nil
+}
+
+// drain reports the outcome of each message until the producer is closed, from
+// a single goroutine so callbacks are invoked one at a time.
+func (p *AsyncPublisher) drain() {
+	defer close(p.drained)
+
+	successes, errs := p.producer.Successes(), p.producer.Errors()
+
+	for successes != nil || errs != nil {
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+
+				continue
+			}
+
+			p.complete(msg, nil)
+		case perr, ok := <-errs:
+			if !ok {
+				errs = nil
+
+				continue
+			}
+
+			p.log.Errorf("failed to publish message with key %v: %v", perr.Msg.Key, perr.Err)
+			p.complete(perr.Msg, perr.Err)
+		}
+	}
+}
+
+// complete releases the slot of the message and invokes its callback, unless
+// the message was already reported as unsent by Close.
+func (p *AsyncPublisher) complete(msg *sarama.ProducerMessage, err error) {
+	p.pendingMu.Lock()
+	done, ok := p.pending[msg]
+	delete(p.pending, msg)
+	p.pendingMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	<-p.slots
+
+	if done == nil {
+		return
+	}
+
+	p.callbackMu.Lock()
+	defer p.callbackMu.Unlock()
+
+	if err != nil {
+		done(Receipt{}, err)
+
+		return
+	}
+
+	done(newReceipt(msg), nil)
+}
+
+// Close stops accepting messages and waits up to the flush timeout for the
+// messages being held to be sent. Messages left unsent are reported to their
+// callback with ErrFlushTimeout, and the returned error wraps ErrFlushTimeout
+// along with their number.
+func (p *AsyncPublisher) Close() error {
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+
+		return nil
+	}
+
+	p.closed = true
+	close(p.closing)
+	p.mu.Unlock()
+
+	p.producer.AsyncClose()
+
+	timer := time.NewTimer(p.flushTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-p.drained:
+		return nil
+	case <-timer.C:
+	}
+
+	p.pendingMu.Lock()
+	unsent := p.pending
+	p.pending = make(map[*sarama.ProducerMessage]DeliveryCallback)
+	p.pendingMu.Unlock()
+
+	if len(unsent) == 0 {
+		return nil
+	}
+
+	p.log.Errorf("%d message(s) left unsent after the flush timeout of %s", len(unsent), p.flushTimeout)
+
+	p.callbackMu.Lock()
+	for _, done := range unsent {
+		if done != nil {
+			done(Receipt{}, ErrFlushTimeout)
+		}
+	}
+	p.callbackMu.Unlock()
+
+	return fmt.Errorf("%w: %d message(s) left unsent", ErrFlushTimeout, len(unsent))
+}
@@ -0,0 +1,217 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// fakeAsyncProducer hands the messages published to the test, which reports
+// their outcome on the Successes and Errors channels.
+type fakeAsyncProducer struct {
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+}
+
+func newFakeAsyncProducer(size int) *fakeAsyncProducer {
+	return &fakeAsyncProducer{
+		input:     make(chan *sarama.ProducerMessage, size),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+	}
+}
+
+func (p *fakeAsyncProducer) AsyncClose() {}
+
+func (p *fakeAsyncProducer) Close() error { return nil }
+
+func (p *fakeAsyncProducer) Input() chan<- *sarama.ProducerMessage { return p.input }
+
+func (p *fakeAsyncProducer) Successes() <-chan *sarama.ProducerMessage { return p.successes }
+
+func (p *fakeAsyncProducer) Errors() <-chan *sarama.ProducerError { return p.errors }
+
+func newTestAsyncPublisher(producer sarama.AsyncProducer, size int) *AsyncPublisher {
+	p := &AsyncPublisher{
+		producer:     producer,
+		topic:        "events",
+		log:          testLogger(),
+		flushTimeout: time.Second,
+		slots:        make(chan struct{}, size),
+		closing:      make(chan struct{}),
+		pending:      make(map[*sarama.ProducerMessage]DeliveryCallback),
+		drained:      make(chan struct{}),
+	}
+
+	go p.drain()
+
+	return p
+}
+
+func TestAsyncPublisherCallbacksOneAtATime(t *testing.T) {
+	const n = 20
+
+	producer := newFakeAsyncProducer(n)
+	p := newTestAsyncPublisher(producer, n)
+
+	var running, overlaps, succeeded, failed int32
+
+	done := func(_ Receipt, err error) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+
+		time.Sleep(time.Millisecond)
+
+		if err != nil {
+			atomic.AddInt32(&failed, 1)
+		} else {
+			atomic.AddInt32(&succeeded, 1)
+		}
+
+		atomic.AddInt32(&running, -1)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := p.PublishAsync(context.Background(), "vm.created", nil, done); err != nil {
+			t.Fatalf("PublishAsync() error = %v", err)
+		}
+	}
+
+	// report the successes and the errors at the same time
+	failure := errors.New("failure")
+	reported := make(chan struct{})
+
+	go func() {
+		defer close(reported)
+
+		for i := 0; i < n; i++ {
+			msg := <-producer.input
+			if i%2 == 0 {
+				go func() { producer.successes <- msg }()
+			} else {
+				go func() { producer.errors <- &sarama.ProducerError{Msg: msg, Err: failure} }()
+			}
+		}
+	}()
+
+	<-reported
+
+	deadline := time.After(5 * time.Second)
+
+	for atomic.LoadInt32(&succeeded)+atomic.LoadInt32(&failed) < n {
+		select {
+		case <-deadline:
+			t.Fatalf("%d callback(s) invoked, want %d", atomic.LoadInt32(&succeeded)+atomic.LoadInt32(&failed), n)
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	close(producer.successes)
+	close(producer.errors)
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if overlaps != 0 {
+		t.Errorf("callbacks overlapped %d time(s)", overlaps)
+	}
+
+	if succeeded != n/2 || failed != n/2 {
+		t.Errorf("succeeded = %d, failed = %d, want %d each", succeeded, failed, n/2)
+	}
+}
+
+func TestAsyncPublisherDrainStopsOnceClosed(t *testing.T) {
+	producer := newFakeAsyncProducer(1)
+	p := newTestAsyncPublisher(producer, 1)
+
+	close(producer.errors)
+
+	var succeeded int32
+
+	if err := p.PublishAsync(context.Background(), "vm.created", nil, func(_ Receipt, err error) {
+		if err == nil {
+			atomic.AddInt32(&succeeded, 1)
+		}
+	}); err != nil {
+		t.Fatalf("PublishAsync() error = %v", err)
+	}
+
+	// the successes are still reported once the errors channel is closed
+	producer.successes <- <-producer.input
+	close(producer.successes)
+
+	select {
+	case <-p.drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not return once both channels were closed")
+	}
+
+	if succeeded != 1 {
+		t.Errorf("succeeded = %d, want 1", succeeded)
+	}
+}
+
+func TestAsyncPublisherFlushTimeoutOneAtATime(t *testing.T) {
+	producer := newFakeAsyncProducer(2)
+	p := newTestAsyncPublisher(producer, 2)
+	p.flushTimeout = 50 * time.Millisecond
+
+	var running, overlaps int32
+
+	started := make(chan struct{})
+	results := make(chan error, 2)
+
+	callback := func(slow bool) DeliveryCallback {
+		return func(_ Receipt, err error) {
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+
+			if slow {
+				close(started)
+				// still running once the flush timeout expired
+				time.Sleep(200 * time.Millisecond)
+			}
+
+			atomic.AddInt32(&running, -1)
+			results <- err
+		}
+	}
+
+	for _, slow := range []bool{true, false} {
+		if err := p.PublishAsync(context.Background(), "vm.created", nil, callback(slow)); err != nil {
+			t.Fatalf("PublishAsync() error = %v", err)
+		}
+	}
+
+	// acknowledge the first message only
+	producer.successes <- <-producer.input
+	<-started
+
+	if err := p.Close(); !errors.Is(err, ErrFlushTimeout) {
+		t.Fatalf("Close() error = %v, want %v", err, ErrFlushTimeout)
+	}
+
+	close(producer.successes)
+	close(producer.errors)
+
+	if err := <-results; err != nil {
+		t.Errorf("acknowledged message reported %v", err)
+	}
+
+	if err := <-results; !errors.Is(err, ErrFlushTimeout) {
+		t.Errorf("unsent message reported %v, want %v", err, ErrFlushTimeout)
+	}
+
+	if overlaps != 0 {
+		t.Errorf("callbacks overlapped %d time(s)", overlaps)
+	}
+}
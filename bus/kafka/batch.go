@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchMaxSize = 100
+	defaultBatchMaxWait = time.Second
+)
+
+// BatchHandler represents a function that handles a batch of consumed messages.
+// The context is cancelled when the Consumer is stopped. Returning a BatchError
+// reports only the listed messages as failed; any other error reports the
+// whole batch as failed so the Consumer can retry it. The request metadata of
+// each message is available with MessageContext.
+type BatchHandler func(context.Context, []*Message) error
+
+// BatchPolicy defines how messages are grouped into batches. A batch is
+// delivered once it holds MaxSize messages or MaxWait elapsed since its first
+// message was received, whichever comes first.
+type BatchPolicy struct {
+	// MaxSize defaults to 100 messages.
+	MaxSize int
+	// MaxWait defaults to one second.
+	MaxWait time.Duration
+}
+
+func (p BatchPolicy) maxSize() int {
+	if p.MaxSize <= 0 {
+		return defaultBatchMaxSize
+	}
+
+	return p.MaxSize
+}
+
+func (p BatchPolicy) maxWait() time.Duration {
+	if p.MaxWait <= 0 {
+		return defaultBatchMaxWait
+	}
+
+	return p.MaxWait
+}
+
+// BatchError is returned by a BatchHandler when only some messages of the batch
+// failed. The messages that are not listed are considered handled.
+type BatchError struct {
+	// Failed maps the index of each failed message in the batch to its error.
+	Failed map[int]error
+}
+
+// Fail records the message at the index of the batch as failed.
+func (e *BatchError) Fail(index int, err error) {
+	if e.Failed == nil {
+		e.Failed = make(map[int]error)
+	}
+
+	e.Failed[index] = err
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d message(s) of the batch failed", len(e.Failed))
+}
+
+// dispatchBatch invokes the batch handler with the subscribed messages that are
+// not duplicates, retrying the messages that failed according to the
+// RetryPolicy. Messages that still fail are routed to the retry or dead-letter
+// topics when configured. It reports whether each message was handled.
+func (d *dispatcher) dispatchBatch(ctx context.Context, msgs []*sarama.ConsumerMessage) []bool {
+	handled := make([]bool, len(msgs))
+	pending := make([]int, 0, len(msgs))
+	messages := make([]*Message, len(msgs))
+	ids := make([]string, len(msgs))
+
+	for i, msg := range msgs {
+		if !d.events.has(string(msg.Key)) {
+			d.log.Debugf("no subscription for key: %s", msg.Key)
+			handled[i] = true
+
+			continue
+		}
+
+		var duplicate bool
+
+		messages[i] = newMessage(msg)
+		if ids[i], duplicate = d.duplicate(ctx, messages[i]); duplicate {
+			handled[i] = true
+
+			continue
+		}
+
+		pending = append(pending, i)
+	}
+
+	d.log.Infof("Received batch of %d message(s), %d subscribed", len(msgs), len(pending))
+
+	failures := make(map[int]error)
+	attempt := 0
+
+	for len(pending) > 0 {
+		attempt++
+
+		batch := make([]*Message, len(pending))
+		for i, idx := range pending {
+			batch[i] = messages[idx]
+		}
+
+		err := d.watchdog.invoke(ctx, fmt.Sprintf("batch of %d message(s)", len(batch)), func(ctx context.Context) error {
+			return d.batchHandler(ctx, batch)
+		})
+		failed := batchFailures(err, len(pending))
+		next := pending[:0]
+
+		for i, idx := range pending {
+			if err, ok := failed[i]; ok {
+				failures[idx] = err
+				next = append(next, idx)
+			} else {
+				delete(failures, idx)
+				handled[idx] = true
+				d.markHandled(ctx, ids[idx])
+			}
+		}
+
+		pending = next
+
+		if len(pending) == 0 || attempt >= d.retry.attempts() {
+			break
+		}
+
+		d.log.Warnf("attempt %d failed for %d message(s) of the batch", attempt, len(pending))
+
+		if werr := d.retry.wait(ctx, attempt); werr != nil {
+			break
+		}
+	}
+
+	for _, idx := range pending {
+		msg, err := msgs[idx], failures[idx]
+
+		d.log.WithFields(logrus.Fields{
+			"topic":     msg.Topic,
+			"partition": msg.Partition,
+			"offset":    msg.Offset,
+		}).Errorf("batch handler failed %d time(s) for message with key %s: %v", attempt, msg.Key, err)
+
+		handled[idx] = d.routeFailure(ctx, msg, attempt, err) == nil
+	}
+
+	return handled
+}
+
+// batchFailures returns the error of each failed message of a batch of the
+// given size, indexed by position in the batch.
+func batchFailures(err error, size int) map[int]error {
+	if err == nil {
+		return nil
+	}
+
+	failed := make(map[int]error)
+
+	var berr *BatchError
+	if stderrors.As(err, &berr) {
+		for i, ferr := range berr.Failed {
+			if ferr == nil {
+				ferr = err
+			}
+
+			if i >= 0 && i < size {
+				failed[i] = ferr
+			}
+		}
+
+		return failed
+	}
+
+	for i := 0; i < size; i++ {
+		failed[i] = err
+	}
+
+	return failed
+}
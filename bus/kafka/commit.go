@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"strings"
+	"sync"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+// DeliveryMode defines when the offset of a message is marked for commit.
+type DeliveryMode int
+
+const (
+	// AtLeastOnce marks the offset of a message only once it was completed,
+	// meaning the handler succeeded or the message was routed to a retry or the
+	// dead-letter topic. A message that failed with nowhere to route it, or
+	// whose handling was interrupted by the Consumer stopping, holds back the
+	// committed offset of its partition, so it is redelivered after a restart
+	// or rebalance along with the messages following it; configure a
+	// dead-letter topic to move past messages that keep failing. Handlers
+	// should be idempotent.
+	AtLeastOnce DeliveryMode = iota
+	// AtMostOnce marks the offset of a message as soon as it is received, before
+	// it is handled. A message is never redelivered, even if the handler failed
+	// or the Consumer stopped before handling it. Suited to fire-and-forget
+	// events where losing a message is preferable to handling it twice.
+	AtMostOnce
+)
+
+// ParseDeliveryMode converts the value "at-least-once" or "at-most-once" into
+// a DeliveryMode. An empty value is the same as "at-least-once".
+func ParseDeliveryMode(val string) (DeliveryMode, error) {
+	switch strings.ToLower(strings.TrimSpace(val)) {
+	case "", "at-least-once":
+		return AtLeastOnce, nil
+	case "at-most-once":
+		return AtMostOnce, nil
+	default:
+		return AtLeastOnce, errors.ConfigurationError("invalid delivery mode: " + val)
+	}
+}
+
+// offsetTracker tracks the messages of a partition being handled and computes
+// the offset that can be committed. Since messages complete out of order when
+// handled in parallel, the committable offset is the offset of the oldest
+// message not yet completed, so no message is skipped on redelivery. Once a
+// message is not completed, the committable offset cannot pass it, so the
+// messages following it are not tracked anymore.
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending []int64
+	handled map[int64]bool
+	// held is the offset of the oldest message that was not completed, or -1.
+	held int64
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{handled: make(map[int64]bool), held: -1}
+}
+
+// add tracks a received message; offsets must be added in increasing order.
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.held >= 0 && offset > t.held {
+		return
+	}
+
+	t.pending = append(t.pending, offset)
+}
+
+// done records whether the message was completed and returns the next offset
+// to commit, reporting false when the committable offset did not advance.
+func (t *offsetTracker) done(offset int64, completed bool) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.held >= 0 && offset > t.held {
+		return 0, false
+	}
+
+	if !completed {
+		t.hold(offset)
+
+		return 0, false
+	}
+
+	t.handled[offset] = true
+
+	next, advanced := int64(0), false
+
+	for len(t.pending) > 0 && t.handled[t.pending[0]] {
+		delete(t.handled, t.pending[0])
+		next, advanced = t.pending[0]+1, true
+		t.pending = t.pending[1:]
+	}
+
+	return next, advanced
+}
+
+// oldest returns the offset of the oldest message not completed yet.
+func (t *offsetTracker) oldest() (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) == 0 {
+		return 0, false
+	}
+
+	return t.pending[0], true
+}
+
+// hold stops tracking the messages following one that was not completed;
+// t.mu must be held.
+func (t *offsetTracker) hold(offset int64) {
+	t.held = offset
+
+	for i, pending := range t.pending {
+		if pending > offset {
+			t.pending = t.pending[:i]
+
+			break
+		}
+	}
+
+	for handled := range t.handled {
+		if handled > offset {
+			delete(t.handled, handled)
+		}
+	}
+}
+
+// committer marks the offsets of the messages of a partition according to the
+// DeliveryMode.
+type committer struct {
+	mode    DeliveryMode
+	tracker *offsetTracker
+	mark    func(offset int64)
+}
+
+func newCommitter(mode DeliveryMode, mark func(offset int64)) *committer {
+	return &committer{
+		mode:    mode,
+		tracker: newOffsetTracker(),
+		mark:    mark,
+	}
+}
+
+// receive is called when a message is received, in offset order, and returns
+// the function to call once the message was dispatched or skipped, reporting
+// whether it was completed. A nil committer does not mark any offset.
+func (c *committer) receive(offset int64) func(completed bool) {
+	if c == nil {
+		return func(bool) {}
+	}
+
+	if c.mode == AtMostOnce {
+		c.mark(offset + 1)
+
+		return func(bool) {}
+	}
+
+	c.tracker.add(offset)
+
+	return func(completed bool) {
+		if next, ok := c.tracker.done(offset, completed); ok {
+			c.mark(next)
+		}
+	}
+}
+
+// uncompleted returns the offset of the oldest message received but not
+// completed yet, reporting false when there is none or offsets are marked on
+// receipt.
+func (c *committer) uncompleted() (int64, bool) {
+	if c == nil || c.mode == AtMostOnce {
+		return 0, false
+	}
+
+	return c.tracker.oldest()
+}
@@ -0,0 +1,162 @@
+package kafka
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestParseDeliveryMode(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    DeliveryMode
+		wantErr bool
+	}{
+		{val: "", want: AtLeastOnce},
+		{val: "at-least-once", want: AtLeastOnce},
+		{val: " At-Most-Once ", want: AtMostOnce},
+		{val: "exactly-once", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDeliveryMode(tt.val)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDeliveryMode(%q) error = %v, wantErr %v", tt.val, err, tt.wantErr)
+
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseDeliveryMode(%q) = %v, want %v", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestOffsetTrackerOutOfOrder(t *testing.T) {
+	tr := newOffsetTracker()
+	for offset := int64(10); offset < 14; offset++ {
+		tr.add(offset)
+	}
+
+	if _, ok := tr.done(12, true); ok {
+		t.Fatal("done(12) advanced while 10 and 11 are pending")
+	}
+
+	if next, ok := tr.done(10, true); !ok || next != 11 {
+		t.Fatalf("done(10) = %d, %v, want 11, true", next, ok)
+	}
+
+	if next, ok := tr.done(11, true); !ok || next != 13 {
+		t.Fatalf("done(11) = %d, %v, want 13, true", next, ok)
+	}
+
+	if next, ok := tr.done(13, true); !ok || next != 14 {
+		t.Fatalf("done(13) = %d, %v, want 14, true", next, ok)
+	}
+}
+
+// markRecorder records the offsets marked by a committer.
+type markRecorder struct {
+	mu      sync.Mutex
+	offsets []int64
+}
+
+func (r *markRecorder) mark(offset int64) {
+	r.mu.Lock()
+	r.offsets = append(r.offsets, offset)
+	r.mu.Unlock()
+}
+
+func (r *markRecorder) marked() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]int64(nil), r.offsets...)
+}
+
+func TestCommitterAtMostOnce(t *testing.T) {
+	rec := &markRecorder{}
+	c := newCommitter(AtMostOnce, rec.mark)
+
+	done := c.receive(5)
+	if got := rec.marked(); len(got) != 1 || got[0] != 6 {
+		t.Fatalf("marked %v on receive, want [6]", got)
+	}
+
+	done(false)
+
+	if got := rec.marked(); len(got) != 1 {
+		t.Fatalf("marked %v after a failure, want [6]", got)
+	}
+}
+
+func TestCommitterAtLeastOnce(t *testing.T) {
+	rec := &markRecorder{}
+	c := newCommitter(AtLeastOnce, rec.mark)
+
+	first, second := c.receive(1), c.receive(2)
+
+	second(true)
+
+	if got := rec.marked(); len(got) != 0 {
+		t.Fatalf("marked %v before the oldest message was handled", got)
+	}
+
+	first(true)
+
+	if got := rec.marked(); len(got) != 1 || got[0] != 3 {
+		t.Fatalf("marked %v, want [3]", got)
+	}
+}
+
+func TestNilCommitter(t *testing.T) {
+	var c *committer
+
+	c.receive(1)(true)
+}
+
+func TestCommitterAtLeastOnceIncomplete(t *testing.T) {
+	rec := &markRecorder{}
+	c := newCommitter(AtLeastOnce, rec.mark)
+
+	if _, ok := c.uncompleted(); ok {
+		t.Fatal("uncompleted() reported a message before any was received")
+	}
+
+	c.receive(1)(false)
+	c.receive(2)(true)
+
+	if got := rec.marked(); len(got) != 0 {
+		t.Fatalf("marked %v past a message that was not completed", got)
+	}
+
+	if offset, ok := c.uncompleted(); !ok || offset != 1 {
+		t.Errorf("uncompleted() = %d, %v, want 1, true", offset, ok)
+	}
+}
+
+func TestOffsetTrackerHeld(t *testing.T) {
+	tr := newOffsetTracker()
+	for offset := int64(10); offset < 14; offset++ {
+		tr.add(offset)
+	}
+
+	tr.done(13, true)
+
+	if _, ok := tr.done(11, false); ok {
+		t.Fatal("done(11, false) advanced")
+	}
+
+	tr.add(14)
+
+	if n := len(tr.pending) + len(tr.handled); n != 2 {
+		t.Errorf("tracker holds %d offset(s) past the held message, want only 10 and 11", n)
+	}
+
+	if next, ok := tr.done(10, true); !ok || next != 11 {
+		t.Fatalf("done(10, true) = %d, %v, want 11, true", next, ok)
+	}
+
+	if _, ok := tr.done(12, true); ok {
+		t.Error("done(12, true) advanced past the held message")
+	}
+}
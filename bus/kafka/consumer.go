@@ -0,0 +1,677 @@
+package kafka
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// defaultRefreshFrequency is how often the topic metadata is refreshed to
+// discover partitions added while the Consumer is running.
+const defaultRefreshFrequency = time.Minute
+
+// Consumer provides a basic Kafka Consumer client. The Consumer reads every
+// partition of its topics and dispatches the messages from a single loop.
+//
+// When a consumer group is configured, the Consumer resumes from and commits
+// offsets to the group according to the delivery mode, without coordinating
+// partition assignment with other group members; use a GroupConsumer for that.
+type Consumer struct {
+	controls
+
+	client    sarama.Client
+	consumer  sarama.Consumer
+	offsets   sarama.OffsetManager
+	delivery  DeliveryMode
+	topics    topicSet
+	refresh   time.Duration
+	start     StartPosition
+	workers   int
+	queueSize int
+	shutdown  time.Duration
+	lagReport time.Duration
+	recovery  RecoveryPolicy
+	errors    errorReporter
+	retrier   *retrier
+
+	mu        sync.Mutex
+	listeners map[TopicPartition]*partitionStream
+	poms      map[TopicPartition]sarama.PartitionOffsetManager
+	commits   map[TopicPartition]*committer
+	// resume holds the next offset of partitions whose PartitionConsumer shut
+	// down, so they are re-created where they stopped.
+	resume map[TopicPartition]int64
+	// failed holds the partitions that are not consumed anymore because their
+	// offset was out of range with the ResetFail policy.
+	failed   map[TopicPartition]bool
+	messages chan *sarama.ConsumerMessage
+	life     *lifecycle
+}
+
+// NewConsumer creates and configures new Consumer.
+func NewConsumer(opts Options, h Handler, events ...string) (*Consumer, error) {
+	return NewMessageConsumer(opts, AdaptHandler(h), events...)
+}
+
+// NewMessageConsumer creates and configures new Consumer that invokes a MessageHandler.
+func NewMessageConsumer(opts Options, h MessageHandler, events ...string) (*Consumer, error) {
+	return newConsumer(opts, target{handler: h}, events...)
+}
+
+// NewBatchConsumer creates and configures new Consumer that invokes a BatchHandler
+// with batches of messages according to the Batch policy of the options. The
+// offsets of a batch are committed once the batch was handled.
+func NewBatchConsumer(opts Options, h BatchHandler, events ...string) (*Consumer, error) {
+	return newConsumer(opts, target{batch: h}, events...)
+}
+
+func newConsumer(opts Options, t target, events ...string) (*Consumer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	topics, err := newTopicSet(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := newDispatcher(opts, t, events...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Consumer{
+		topics:    topics,
+		refresh:   opts.Consumer.RefreshFrequency,
+		start:     opts.Consumer.Start,
+		workers:   opts.Consumer.Workers,
+		queueSize: opts.Consumer.QueueSize,
+		controls: controls{
+			log:        opts.Logger,
+			dispatcher: d,
+			pauser:     newPauser(opts.Logger, opts.Consumer.Backpressure),
+			positions:  newLagTracker(),
+		},
+		errors:    errorReporter{log: opts.Logger, handler: opts.Consumer.ErrorHandler},
+		lagReport: opts.Consumer.LagInterval,
+		delivery:  opts.Consumer.Delivery,
+		listeners: make(map[TopicPartition]*partitionStream),
+		poms:      make(map[TopicPartition]sarama.PartitionOffsetManager),
+		commits:   make(map[TopicPartition]*committer),
+		resume:    make(map[TopicPartition]int64),
+		failed:    make(map[TopicPartition]bool),
+		recovery:  opts.Consumer.Recovery,
+		messages:  make(chan *sarama.ConsumerMessage),
+		shutdown:  opts.Consumer.ShutdownTimeout,
+		life:      newLifecycle(),
+	}
+
+	if c.refresh <= 0 {
+		c.refresh = defaultRefreshFrequency
+	}
+
+	if c.shutdown <= 0 {
+		c.shutdown = defaultShutdownTimeout
+	}
+
+	if err = c.configure(opts); err != nil {
+		opts.Logger.Errorf("error in configuring consumer: %v", err)
+		c.Close()
+
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// newConsumerConfig creates the sarama configuration shared by the consumers.
+// Errors are always returned so they can be reported instead of being dropped.
+func newConsumerConfig(opts Options) (*sarama.Config, error) {
+	tlsConfig, err := LoadClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	config := sarama.NewConfig()
+	config.Version = opts.kafkaVersion()
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = opts.Consumer.Start.initial()
+
+	if opts.Consumer.CommitInterval > 0 {
+		config.Consumer.Offsets.AutoCommit.Interval = opts.Consumer.CommitInterval
+	}
+
+	if tlsConfig != nil {
+		config.Net.TLS.Config = tlsConfig
+		config.Net.TLS.Enable = true
+	} else {
+		opts.Logger.Warn("No client certificates provided; connection will be attempted without authentication")
+	}
+
+	return config, nil
+}
+
+func (c *Consumer) configure(opts Options) error {
+	config, err := newConsumerConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	c.client, err = sarama.NewClient(opts.Hosts, config)
+	if err != nil {
+		return err
+	}
+
+	c.consumer, err = sarama.NewConsumerFromClient(c.client)
+	if err != nil {
+		return err
+	}
+
+	if opts.Consumer.GroupID != "" {
+		c.offsets, err = sarama.NewOffsetManagerFromClient(opts.Consumer.GroupID, c.client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(opts.Consumer.RetryTiers) > 0 {
+		if c.retrier, err = newRetrier(opts, c.dispatcher, c.errors); err != nil {
+			return err
+		}
+	}
+
+	return c.consumePartitions(c.start)
+}
+
+// consumePartitions starts a PartitionConsumer for each partition of the topics
+// that is not consumed yet. Partitions are started from the provided position.
+func (c *Consumer) consumePartitions(start StartPosition) error {
+	topics, err := c.topics.resolve(c.client)
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range topics {
+		if err = c.consumeTopic(topic, start); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Consumer) consumeTopic(topic string, start StartPosition) error {
+	partitions, err := c.client.Partitions(topic)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, partition := range partitions {
+		tp := TopicPartition{Topic: topic, Partition: partition}
+
+		if _, ok := c.listeners[tp]; ok || c.failed[tp] {
+			continue
+		}
+
+		if err = c.consumePartition(tp, start); err != nil {
+			var cerr *ConsumerError
+			if !stderrors.As(err, &cerr) {
+				return err
+			}
+
+			c.errors.report(err)
+		}
+	}
+
+	return nil
+}
+
+// consumePartition starts a PartitionConsumer for the partition, applying the
+// offset reset policy when the start offset is out of range; c.mu must be held.
+func (c *Consumer) consumePartition(tp TopicPartition, start StartPosition) error {
+	if err := c.manage(tp); err != nil {
+		return err
+	}
+
+	offset, err := c.startOffset(start, tp)
+	if err != nil {
+		return err
+	}
+
+	listener, err := c.consumer.ConsumePartition(tp.Topic, tp.Partition, offset)
+	if stderrors.Is(err, sarama.ErrOffsetOutOfRange) {
+		reset, ok := c.recovery.OffsetReset.offset()
+		if !ok {
+			c.log.Errorf("offset %d of partition %d of topic %s is out of range; partition will not be consumed", offset, tp.Partition, tp.Topic)
+			c.failed[tp] = true
+			delete(c.resume, tp)
+
+			return &ConsumerError{Topic: tp.Topic, Partition: tp.Partition, Err: err}
+		}
+
+		c.log.Warnf("offset %d of partition %d of topic %s is out of range; consuming from %s", offset, tp.Partition, tp.Topic, c.recovery.OffsetReset)
+		offset = reset
+		listener, err = c.consumer.ConsumePartition(tp.Topic, tp.Partition, offset)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	offset = resolveOffset(c.client, tp, offset)
+
+	stream := &partitionStream{PartitionConsumer: listener, stop: make(chan struct{})}
+	c.listeners[tp] = stream
+	c.positions.track(tp, offset, listener)
+	delete(c.resume, tp)
+
+	mark := func(int64) {}
+	if pom, ok := c.poms[tp]; ok {
+		mark = func(offset int64) { pom.MarkOffset(offset, "") }
+	}
+
+	c.commits[tp] = newCommitter(c.delivery, mark)
+
+	c.log.Infof("consuming partition %d of topic %s from offset %d", tp.Partition, tp.Topic, offset)
+
+	go c.forward(tp, stream, offset)
+	go c.forwardErrors(listener)
+
+	return nil
+}
+
+// partitionStream is the PartitionConsumer of a partition along with the
+// channel closed once it is closed by the Consumer, to tell it apart from a
+// stream that stopped on its own.
+type partitionStream struct {
+	sarama.PartitionConsumer
+	stop chan struct{}
+}
+
+// close stops forwarding the messages of the stream and closes it.
+func (s *partitionStream) close() {
+	close(s.stop)
+	// always returned as nil within library
+	_ = s.Close()
+}
+
+// startOffset returns the offset a partition is started from. A partition that
+// is being recovered resumes where it stopped, otherwise it resumes from the
+// offset committed to the consumer group. The start position only applies to
+// partitions without a committed offset, so it is not applied again on restart.
+func (c *Consumer) startOffset(start StartPosition, tp TopicPartition) (int64, error) {
+	if offset, ok := c.resume[tp]; ok {
+		return offset, nil
+	}
+
+	if pom, ok := c.poms[tp]; ok {
+		// the initial offset of the config when nothing was committed
+		if offset, _ := pom.NextOffset(); offset >= 0 {
+			return offset, nil
+		}
+	}
+
+	return start.offset(c.client, tp)
+}
+
+// manage starts managing the committed offset of the partition when offsets
+// are committed to a consumer group.
+func (c *Consumer) manage(tp TopicPartition) error {
+	if _, ok := c.poms[tp]; ok || c.offsets == nil {
+		return nil
+	}
+
+	pom, err := c.offsets.ManagePartition(tp.Topic, tp.Partition)
+	if err != nil {
+		return err
+	}
+
+	c.poms[tp] = pom
+
+	go c.forwardErrors(pom)
+
+	return nil
+}
+
+// forward passes the messages of a single partition to the dispatch loop. It
+// holds the messages while the partition is paused, which stops fetching once
+// the buffer of the PartitionConsumer is full. When the stream stops on its
+// own, the partition is recovered from the offset following the last message
+// read, or from the start offset when no message was read.
+func (c *Consumer) forward(tp TopicPartition, stream *partitionStream, start int64) {
+	defer c.positions.untrack(tp, stream.PartitionConsumer)
+
+	next := start
+
+	for msg := range stream.Messages() {
+		next = msg.Offset + 1
+		c.positions.read(msg)
+
+		if !c.pauser.wait(tp, stream.stop) {
+			return
+		}
+
+		select {
+		case c.messages <- msg:
+		case <-stream.stop:
+			return
+		}
+	}
+
+	select {
+	case <-stream.stop:
+		return
+	default:
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.listeners[tp] != stream {
+		// replaced while it was stopping
+		return
+	}
+
+	// the PartitionConsumer shut down on its own (e.g. the offset went out of
+	// range or the broker could not be reached)
+	c.log.Warnf("consumer of partition %d of topic %s stopped at offset %d; recovering it", tp.Partition, tp.Topic, next)
+
+	delete(c.listeners, tp)
+
+	if next >= 0 {
+		c.resume[tp] = next
+	}
+
+	go c.recover(tp)
+}
+
+// recover re-creates the PartitionConsumer of a partition whose stream stopped,
+// waiting for an exponential backoff before each attempt. It gives up once the
+// partition was re-created by a metadata refresh, the offset reset policy
+// failed the partition or the Consumer is closed.
+func (c *Consumer) recover(tp TopicPartition) {
+	for attempt := 1; ; attempt++ {
+		delay := c.recovery.backoff(attempt)
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-c.life.done:
+			timer.Stop()
+
+			return
+		}
+
+		c.mu.Lock()
+
+		if _, ok := c.listeners[tp]; ok || c.failed[tp] || c.life.isClosed() {
+			c.mu.Unlock()
+
+			return
+		}
+
+		c.log.Infof("re-creating consumer of partition %d of topic %s (attempt %d, after %s)", tp.Partition, tp.Topic, attempt, delay)
+		err := c.consumePartition(tp, c.start)
+		c.mu.Unlock()
+
+		if err == nil {
+			c.log.Infof("recovered consumer of partition %d of topic %s after %d attempt(s)", tp.Partition, tp.Topic, attempt)
+
+			return
+		}
+
+		var cerr *ConsumerError
+		if stderrors.As(err, &cerr) {
+			c.errors.report(err)
+
+			return
+		}
+
+		c.log.Warnf("attempt %d to re-create consumer of partition %d of topic %s failed: %v", attempt, tp.Partition, tp.Topic, err)
+	}
+}
+
+// forwardErrors reports the errors of a single partition.
+func (c *Consumer) forwardErrors(source interface {
+	Errors() <-chan *sarama.ConsumerError
+}) {
+	for err := range source.Errors() {
+		c.errors.report(err)
+	}
+}
+
+// refreshPartitions refreshes the topic metadata and starts consuming any
+// partition or matching topic added since the last refresh. New partitions are
+// read from the oldest offset so messages published before they were
+// discovered are kept.
+func (c *Consumer) refreshPartitions() {
+	if err := c.topics.refresh(c.client); err != nil {
+		c.errors.report(fmt.Errorf("error in refreshing topic metadata: %w", err))
+
+		return
+	}
+
+	if err := c.consumePartitions(StartPosition{From: StartOldest}); err != nil {
+		c.errors.report(fmt.Errorf("error in consuming new partitions: %w", err))
+	}
+}
+
+// Close stops the Consumer if it is running, waits for it to drain and then
+// closes the resources in use.
+func (c *Consumer) Close() {
+	if !c.life.close() {
+		return
+	}
+
+	c.mu.Lock()
+	for _, stream := range c.listeners {
+		stream.close()
+	}
+
+	for _, pom := range c.poms {
+		pom.AsyncClose()
+	}
+	c.mu.Unlock()
+
+	if c.retrier != nil {
+		c.retrier.close()
+	}
+
+	if c.offsets != nil {
+		// flushes the marked offsets
+		_ = c.offsets.Close()
+	}
+
+	if c.consumer != nil {
+		// always returned as nil within library
+		_ = c.consumer.Close()
+	}
+
+	if c.client != nil {
+		_ = c.client.Close()
+	}
+
+	c.dispatcher.close()
+	c.log.Info("consumer has been closed")
+}
+
+// Start will start listening for messages and call the provided handler
+// for any event that was subscribed. The channel is used to stop listening
+// for messages.
+func (c *Consumer) Start(stop <-chan bool) {
+	runUntil(stop, c.Run, c.log)
+}
+
+// Run listens for messages and calls the provided handler for any event that
+// was subscribed until the context is cancelled or the Consumer is closed.
+// Once stopped, no more messages are read and Run waits up to the shutdown
+// timeout for the messages being handled to complete; queued messages that
+// were not started are dropped. The dropped messages, like the messages whose
+// handling failed, hold back the committed offset so they are redelivered
+// after a restart, and their partitions are read again from the oldest of them
+// so they are redelivered when Run is called again. Run returns nil when
+// stopped by the context, ErrConsumerClosed when the Consumer was closed and
+// ErrShutdownTimeout when the handlers did not complete in time, in which case
+// their context is cancelled.
+func (c *Consumer) Run(ctx context.Context) error {
+	if err := c.life.begin(); err != nil {
+		return err
+	}
+	defer c.life.end()
+
+	ctx, cancel := c.life.context(ctx)
+	defer cancel()
+
+	// handlers are not cancelled when fetching stops, so they get the chance
+	// to complete within the shutdown timeout.
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+
+	stopping := make(chan struct{})
+
+	ticker := time.NewTicker(c.refresh)
+	defer ticker.Stop()
+
+	pool := newWorkerPool(c.dispatcher, c.workers, c.queueSize)
+
+	if c.lagReport > 0 {
+		go c.positions.report(ctx, c.lagReport, c.log)
+	}
+
+	retrying := c.retrier.start(ctx, handlerCtx)
+
+	var inflight sync.WaitGroup
+
+ConsumerLoop:
+	for {
+		select {
+		case msg := <-c.messages:
+			inflight.Add(1)
+			c.pauser.acquire()
+
+			commit := c.committer(TopicPartition{Topic: msg.Topic, Partition: msg.Partition}).receive(msg.Offset)
+			done := func(completed bool) {
+				commit(completed)
+				c.pauser.release()
+				inflight.Done()
+			}
+
+			if err := pool.submit(ctx, job{ctx: handlerCtx, msg: msg, skip: stopping, done: done}); err != nil {
+				c.pauser.release()
+				inflight.Done()
+
+				break ConsumerLoop
+			}
+		case <-ticker.C:
+			c.refreshPartitions()
+		case <-ctx.Done():
+			break ConsumerLoop
+		}
+	}
+
+	close(stopping)
+
+	err := c.drain(&inflight, cancelHandlers)
+	if err == nil && !waitDone(retrying, c.shutdown) {
+		cancelHandlers()
+		err = ErrShutdownTimeout
+	}
+
+	if c.offsets != nil {
+		// flush the offsets of the messages handled before stopping
+		c.offsets.Commit()
+	}
+
+	c.reseek()
+
+	if err != nil {
+		// do not wait on handlers that ignore the cancellation
+		go pool.stop()
+
+		return err
+	}
+
+	pool.stop()
+
+	if c.life.isClosed() {
+		return ErrConsumerClosed
+	}
+
+	return nil
+}
+
+// committer returns the committer of the partition, which is nil when offsets
+// are not committed.
+func (c *Consumer) committer(tp TopicPartition) *committer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.commits[tp]
+}
+
+// reseek re-creates the stream of each partition whose messages were received
+// but not completed once Run stopped, e.g. because they were dropped or their
+// handler failed, from the oldest of them so they are redelivered by the next
+// Run. A partition being recovered is recovered from there.
+func (c *Consumer) reseek() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.life.isClosed() {
+		return
+	}
+
+	for tp, commits := range c.commits {
+		offset, ok := commits.uncompleted()
+		if !ok {
+			continue
+		}
+
+		if resume, ok := c.resume[tp]; !ok || offset < resume {
+			c.resume[tp] = offset
+		}
+
+		stream, ok := c.listeners[tp]
+		if !ok {
+			continue
+		}
+
+		stream.close()
+		delete(c.listeners, tp)
+
+		c.log.Infof("re-reading partition %d of topic %s from offset %d, the oldest message not completed", tp.Partition, tp.Topic, offset)
+
+		if err := c.consumePartition(tp, c.start); err != nil {
+			var cerr *ConsumerError
+			if stderrors.As(err, &cerr) {
+				c.errors.report(err)
+
+				continue
+			}
+
+			c.log.Warnf("error in re-creating consumer of partition %d of topic %s: %v", tp.Partition, tp.Topic, err)
+
+			go c.recover(tp)
+		}
+	}
+}
+
+// drain waits up to the shutdown timeout for the in-flight messages and cancels
+// the handlers if they did not complete in time.
+func (c *Consumer) drain(inflight *sync.WaitGroup, cancelHandlers context.CancelFunc) error {
+	if waitTimeout(inflight, c.shutdown) {
+		return nil
+	}
+
+	cancelHandlers()
+	c.log.Warnf("in-flight messages did not complete within %s", c.shutdown)
+
+	return ErrShutdownTimeout
+}
@@ -0,0 +1,354 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// newTestConsumer creates a Consumer reading the messages sent on its messages
+// channel, without any partition.
+func newTestConsumer(t *testing.T, opts Options, h MessageHandler) *Consumer {
+	t.Helper()
+
+	return &Consumer{
+		refresh:  time.Hour,
+		workers:  opts.Consumer.Workers,
+		shutdown: opts.Consumer.ShutdownTimeout,
+		controls: controls{
+			log:        testLogger(),
+			dispatcher: newTestDispatcher(t, opts, target{handler: h}),
+			pauser:     newPauser(testLogger(), Backpressure{}),
+			positions:  newLagTracker(),
+		},
+		errors:    errorReporter{log: testLogger()},
+		listeners: make(map[TopicPartition]*partitionStream),
+		poms:      make(map[TopicPartition]sarama.PartitionOffsetManager),
+		commits:   make(map[TopicPartition]*committer),
+		resume:    make(map[TopicPartition]int64),
+		failed:    make(map[TopicPartition]bool),
+		messages:  make(chan *sarama.ConsumerMessage),
+		life:      newLifecycle(),
+	}
+}
+
+// blockingHandler returns a handler that ignores the cancellation of its
+// context and returns once release is closed, signalling started when called.
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) MessageHandler {
+	return func(context.Context, *Message) error {
+		started <- struct{}{}
+		<-release
+
+		return nil
+	}
+}
+
+func TestConsumerRunDrain(t *testing.T) {
+	// 0 is the default of Options and 1 the default of the bus configuration
+	for _, workers := range []int{0, 1} {
+		started, release := make(chan struct{}, 1), make(chan struct{})
+
+		var opts Options
+		opts.Consumer.Workers = workers
+		opts.Consumer.ShutdownTimeout = 100 * time.Millisecond
+
+		c := newTestConsumer(t, opts, blockingHandler(started, release))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan error, 1)
+
+		go func() { stopped <- c.Run(ctx) }()
+
+		c.messages <- &sarama.ConsumerMessage{Topic: "events", Key: []byte("vm.created")}
+		<-started
+		cancel()
+
+		select {
+		case err := <-stopped:
+			if !errors.Is(err, ErrShutdownTimeout) {
+				t.Errorf("workers %d: Run() error = %v, want %v", workers, err, ErrShutdownTimeout)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("workers %d: Run() did not return after the shutdown timeout", workers)
+		}
+
+		close(release)
+	}
+}
+
+// newConsumerBroker starts a broker leading partition 0 of the events topic,
+// which holds the given number of messages from offset 0.
+func newConsumerBroker(t *testing.T, messages int) *sarama.MockBroker {
+	t.Helper()
+
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(consumerResponses(t, broker, map[TopicPartition]int{{Topic: "events"}: messages}))
+
+	return broker
+}
+
+// consumerResponses returns the responses of a broker leading the partitions,
+// each holding the given number of messages from offset 0.
+func consumerResponses(t *testing.T, broker *sarama.MockBroker, partitions map[TopicPartition]int) map[string]sarama.MockResponse {
+	t.Helper()
+
+	metadata := sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID())
+	offsets := sarama.NewMockOffsetResponse(t).SetVersion(1)
+	fetch := sarama.NewMockFetchResponse(t, 1).SetVersion(4)
+
+	for tp, messages := range partitions {
+		metadata.SetLeader(tp.Topic, tp.Partition, broker.BrokerID())
+		offsets.SetOffset(tp.Topic, tp.Partition, sarama.OffsetOldest, 0).
+			SetOffset(tp.Topic, tp.Partition, sarama.OffsetNewest, int64(messages))
+		fetch.SetHighWaterMark(tp.Topic, tp.Partition, int64(messages))
+
+		for offset := 0; offset < messages; offset++ {
+			fetch.SetMessage(tp.Topic, tp.Partition, int64(offset), sarama.StringEncoder("{}"))
+		}
+	}
+
+	return map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"OffsetRequest":   offsets,
+		"FetchRequest":    fetch,
+	}
+}
+
+// partitionRecorder returns a handler recording the partition of each message
+// it handles.
+func partitionRecorder(handled chan<- TopicPartition) MessageHandler {
+	return func(_ context.Context, msg *Message) error {
+		handled <- TopicPartition{Topic: msg.Topic, Partition: msg.Partition}
+
+		return nil
+	}
+}
+
+// expectPartitions waits for the given number of messages to be handled from
+// each partition.
+func expectPartitions(t *testing.T, handled <-chan TopicPartition, want map[TopicPartition]int) {
+	t.Helper()
+
+	total := 0
+	for _, messages := range want {
+		total += messages
+	}
+
+	got := make(map[TopicPartition]int)
+
+	for i := 0; i < total; i++ {
+		select {
+		case tp := <-handled:
+			got[tp]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("handled messages %v, want %v", got, want)
+		}
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("handled messages %v, want %v", got, want)
+	}
+}
+
+// newBrokerConsumer creates a Consumer of the events topic reading from the
+// broker from the oldest offset.
+func newBrokerConsumer(t *testing.T, broker *sarama.MockBroker, opts Options, h MessageHandler) *Consumer {
+	t.Helper()
+
+	opts.Logger = testLogger()
+	opts.Hosts = []string{broker.Addr()}
+	opts.Topic = "events"
+	opts.Consumer.Start.From = StartOldest
+
+	c, err := NewMessageConsumer(opts, h, SubscribeAll)
+	if err != nil {
+		t.Fatalf("NewMessageConsumer() error = %v", err)
+	}
+
+	return c
+}
+
+func TestConsumerRunRereadsUncompleted(t *testing.T) {
+	broker := newConsumerBroker(t, 3)
+	defer broker.Close()
+
+	handled := make(chan int64, 10)
+	failed := false
+
+	c := newBrokerConsumer(t, broker, Options{}, func(_ context.Context, msg *Message) error {
+		handled <- msg.Offset
+
+		if msg.Offset == 1 && !failed {
+			failed = true
+
+			return errors.New("failure")
+		}
+
+		return nil
+	})
+	defer c.Close()
+
+	run := func(want ...int64) {
+		t.Helper()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan error, 1)
+
+		go func() { stopped <- c.Run(ctx) }()
+
+		for _, offset := range want {
+			select {
+			case got := <-handled:
+				if got != offset {
+					t.Fatalf("handled offset %d, want %d", got, offset)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("offset %d not handled", offset)
+			}
+		}
+
+		cancel()
+
+		if err := <-stopped; err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+
+	run(0, 1, 2)
+	// the failed message and the messages following it are read again
+	run(1, 2)
+}
+
+func TestConsumerRunRereadsSkipped(t *testing.T) {
+	broker := newConsumerBroker(t, 3)
+	defer broker.Close()
+
+	handled := make(chan int64, 10)
+	started, release := make(chan struct{}, 1), make(chan struct{})
+
+	var opts Options
+	opts.Consumer.ShutdownTimeout = 100 * time.Millisecond
+
+	c := newBrokerConsumer(t, broker, opts, func(_ context.Context, msg *Message) error {
+		if msg.Offset == 0 {
+			select {
+			case started <- struct{}{}:
+				<-release
+			default:
+			}
+		}
+
+		handled <- msg.Offset
+
+		return nil
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+
+	go func() { stopped <- c.Run(ctx) }()
+
+	<-started
+
+	// wait for the messages following the first one to be queued
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		c.pauser.mu.Lock()
+		inflight := c.pauser.inflight
+		c.pauser.mu.Unlock()
+
+		if inflight == 3 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%d message(s) in flight, want 3", inflight)
+		}
+	}
+
+	cancel()
+
+	if err := <-stopped; !errors.Is(err, ErrShutdownTimeout) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrShutdownTimeout)
+	}
+
+	// the first message completes late, then the queued messages are skipped
+	close(release)
+
+	if got := <-handled; got != 0 {
+		t.Fatalf("handled offset %d, want 0", got)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { stopped <- c.Run(ctx) }()
+
+	// the messages that were not completed when Run stopped are read again
+	for _, want := range []int64{0, 1, 2} {
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Fatalf("handled offset %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("offset %d not handled", want)
+		}
+	}
+}
+
+func TestConsumerPartitions(t *testing.T) {
+	first, second := TopicPartition{Topic: "events", Partition: 0}, TopicPartition{Topic: "events", Partition: 1}
+	partitions := map[TopicPartition]int{first: 2, second: 3}
+
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(consumerResponses(t, broker, partitions))
+
+	handled := make(chan TopicPartition, 10)
+
+	c := newBrokerConsumer(t, broker, Options{}, partitionRecorder(handled))
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = c.Run(ctx) }()
+
+	// every partition of the topic is read
+	expectPartitions(t, handled, partitions)
+}
+
+func TestConsumerRefreshPartitions(t *testing.T) {
+	first, second := TopicPartition{Topic: "events", Partition: 0}, TopicPartition{Topic: "events", Partition: 1}
+
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(consumerResponses(t, broker, map[TopicPartition]int{first: 1}))
+
+	handled := make(chan TopicPartition, 10)
+
+	var opts Options
+	opts.Consumer.RefreshFrequency = 50 * time.Millisecond
+
+	c := newBrokerConsumer(t, broker, opts, partitionRecorder(handled))
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = c.Run(ctx) }()
+
+	expectPartitions(t, handled, map[TopicPartition]int{first: 1})
+
+	// a partition added to the topic is read from its oldest message
+	broker.SetHandlerByMap(consumerResponses(t, broker, map[TopicPartition]int{first: 1, second: 2}))
+
+	expectPartitions(t, handled, map[TopicPartition]int{second: 2})
+}
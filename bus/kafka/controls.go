@@ -0,0 +1,55 @@
+package kafka
+
+import "github.com/sirupsen/logrus"
+
+// controls implements the methods shared by the Consumer and the GroupConsumer
+// to change what a running consumer handles.
+type controls struct {
+	log        logrus.FieldLogger
+	dispatcher *dispatcher
+	pauser     *pauser
+	positions  *lagTracker
+}
+
+// Subscribe adds events to the subscriptions of the consumer. An event is either
+// a message key or a glob pattern such as "vm.*"; SubscribeAll subscribes to
+// every key. It is safe to call while the consumer is running.
+func (c *controls) Subscribe(events ...string) error {
+	return c.dispatcher.events.add(events...)
+}
+
+// Unsubscribe removes events, given as they were subscribed, from the
+// subscriptions of the consumer. It is safe to call while the consumer is running.
+func (c *controls) Unsubscribe(events ...string) {
+	c.dispatcher.events.remove(events...)
+}
+
+// Pause stops reading messages from the partitions, or from every partition
+// when none is given. Messages already read are still handled. Partitions stay
+// assigned to a GroupConsumer while paused, and a paused partition that is
+// re-assigned remains paused. It is safe to call while the consumer is running.
+func (c *controls) Pause(partitions ...TopicPartition) {
+	c.pauser.pause(partitions...)
+	c.log.Infof("consumption paused: %v", describePartitions(partitions))
+}
+
+// Resume resumes reading messages from the partitions, or from every partition
+// when none is given; resuming partitions while every partition is paused
+// resumes only them. A partition stays paused while the backpressure
+// high-water mark is exceeded. It is safe to call while the consumer is running.
+func (c *controls) Resume(partitions ...TopicPartition) {
+	c.pauser.resume(partitions...)
+	c.log.Infof("consumption resumed: %v", describePartitions(partitions))
+}
+
+// Lag returns the current offset, high-water mark and lag of each partition
+// being read by the consumer.
+func (c *controls) Lag() []PartitionLag {
+	return c.positions.lag()
+}
+
+// HandlerTimeouts returns the number of handlers that exceeded the handler
+// timeout since the consumer was created.
+func (c *controls) HandlerTimeouts() int64 {
+	return c.dispatcher.watchdog.count()
+}
@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers added to a message routed to the dead-letter topic.
+const (
+	// HeaderDeadLetterError contains the error returned by the last attempt.
+	HeaderDeadLetterError = "bus-dlq-error"
+	// HeaderDeadLetterAttempts contains the number of times the message was handled.
+	HeaderDeadLetterAttempts = "bus-dlq-attempts"
+	// HeaderDeadLetterTopic contains the topic the message was originally
+	// consumed from, before being routed to any retry topic.
+	HeaderDeadLetterTopic = "bus-dlq-source-topic"
+	// HeaderDeadLetterPartition contains the partition the message was originally consumed from.
+	HeaderDeadLetterPartition = "bus-dlq-source-partition"
+	// HeaderDeadLetterOffset contains the offset the message was originally consumed from.
+	HeaderDeadLetterOffset = "bus-dlq-source-offset"
+	// HeaderDeadLetterTimestamp contains the time the message was dead-lettered (RFC3339).
+	HeaderDeadLetterTimestamp = "bus-dlq-timestamp"
+)
+
+// deadLetter publishes messages whose handler kept failing to a dead-letter topic.
+type deadLetter struct {
+	topic    string
+	producer sarama.SyncProducer
+	log      logrus.FieldLogger
+}
+
+func newDeadLetter(opts Options) (*deadLetter, error) {
+	producer, err := makeFactory(opts)()
+	if err != nil {
+		return nil, err
+	}
+
+	return &deadLetter{
+		topic:    opts.Consumer.DeadLetterTopic,
+		producer: producer,
+		log:      opts.Logger,
+	}, nil
+}
+
+// publish writes the message to the dead-letter topic keeping its original key,
+// value and headers, and adds headers describing the failure.
+func (dl *deadLetter) publish(msg *sarama.ConsumerMessage, attempts int, cause error) error {
+	src := origin(msg)
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+6)
+
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers = append(headers, *h)
+		}
+	}
+
+	headers = append(headers,
+		recordHeader(HeaderDeadLetterError, cause.Error()),
+		recordHeader(HeaderDeadLetterAttempts, strconv.Itoa(attempts)),
+		recordHeader(HeaderDeadLetterTopic, src.topic),
+		recordHeader(HeaderDeadLetterPartition, strconv.FormatInt(int64(src.partition), 10)),
+		recordHeader(HeaderDeadLetterOffset, strconv.FormatInt(src.offset, 10)),
+		recordHeader(HeaderDeadLetterTimestamp, time.Now().UTC().Format(time.RFC3339Nano)),
+	)
+
+	partition, offset, err := dl.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   dl.topic,
+		Key:     sarama.ByteEncoder(msg.Key),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	dl.log.WithFields(logrus.Fields{
+		"topic":     dl.topic,
+		"partition": partition,
+		"offset":    offset,
+	}).Warnf("message with key %s from %s routed to dead-letter topic", msg.Key, src)
+
+	return nil
+}
+
+func (dl *deadLetter) close() {
+	if err := dl.producer.Close(); err != nil {
+		dl.log.Errorf("error in closing dead-letter producer: %v", err)
+	}
+}
+
+func recordHeader(key, value string) sarama.RecordHeader {
+	return sarama.RecordHeader{Key: []byte(key), Value: []byte(value)}
+}
@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// HeaderMessageID contains the ID used by default to detect duplicate messages.
+// Producers set it on every message, from Record.ID or as a random UUID.
+const HeaderMessageID = "bus-message-id"
+
+// defaultDedupCapacity is the number of IDs held by a MemoryDedupStore when no
+// capacity is provided.
+const defaultDedupCapacity = 10000
+
+// DedupStore records the IDs of the messages that were handled, so duplicates
+// are skipped instead of being handled again. Implementations must be safe for
+// concurrent use; a shared store, such as Redis or a database, deduplicates
+// messages across Consumer instances.
+type DedupStore interface {
+	// Seen reports whether a message with the ID was already handled.
+	Seen(ctx context.Context, id string) (bool, error)
+	// Mark records that a message with the ID was handled.
+	Mark(ctx context.Context, id string) error
+}
+
+// DedupKeyFunc returns the ID used to detect duplicates of a message, and
+// reports false when the message must not be deduplicated.
+type DedupKeyFunc func(*Message) (string, bool)
+
+// Deduplication defines how a Consumer detects duplicate messages.
+type Deduplication struct {
+	// Store records the handled messages. Messages are not deduplicated when nil.
+	Store DedupStore
+	// Key returns the ID of a message. Defaults to MessageIDKey.
+	Key DedupKeyFunc
+}
+
+// MessageIDKey returns the value of the HeaderMessageID header as the ID of the
+// message. Messages without the header are not deduplicated.
+func MessageIDKey(msg *Message) (string, bool) {
+	id, ok := msg.Header(HeaderMessageID)
+
+	return string(id), ok && len(id) > 0
+}
+
+// duplicate returns the ID of the message and reports whether it was already
+// handled. A message is handled again when the store cannot be queried.
+func (d *dispatcher) duplicate(ctx context.Context, msg *Message) (string, bool) {
+	if d.dedup.Store == nil {
+		return "", false
+	}
+
+	key := d.dedup.Key
+	if key == nil {
+		key = MessageIDKey
+	}
+
+	id, ok := key(msg)
+	if !ok {
+		return "", false
+	}
+
+	seen, err := d.dedup.Store.Seen(ctx, id)
+	if err != nil {
+		d.log.Errorf("error in checking for duplicate of message with key %s: %v", msg.Key, err)
+
+		return id, false
+	}
+
+	if seen {
+		d.log.Infof("skipping duplicate message %s with key %s", id, msg.Key)
+	}
+
+	return id, seen
+}
+
+// markHandled records the ID of a message that was handled successfully.
+func (d *dispatcher) markHandled(ctx context.Context, id string) {
+	if d.dedup.Store == nil || id == "" {
+		return
+	}
+
+	if err := d.dedup.Store.Mark(ctx, id); err != nil {
+		d.log.Errorf("error in recording handled message %s: %v", id, err)
+	}
+}
+
+// MemoryDedupStore is a DedupStore that keeps the IDs of the most recently
+// handled messages in memory. It only deduplicates messages handled by the
+// same process and forgets them when restarted.
+type MemoryDedupStore struct {
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order holds the entries from the most to the least recently marked.
+	order *list.List
+}
+
+type dedupEntry struct {
+	id      string
+	expires time.Time
+}
+
+// NewMemoryDedupStore creates a MemoryDedupStore holding up to capacity IDs,
+// 10000 by default; the least recently marked ID is evicted once full. IDs also
+// expire after the ttl, unless it is zero.
+func NewMemoryDedupStore(capacity int, ttl time.Duration) *MemoryDedupStore {
+	if capacity <= 0 {
+		capacity = defaultDedupCapacity
+	}
+
+	return &MemoryDedupStore{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Seen reports whether the ID was marked and has not expired or been evicted.
+func (s *MemoryDedupStore) Seen(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[id]
+	if !ok {
+		return false, nil
+	}
+
+	if s.expired(elem.Value.(*dedupEntry), time.Now()) {
+		s.remove(elem)
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Mark records the ID, evicting the least recently marked IDs above capacity.
+func (s *MemoryDedupStore) Mark(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry := &dedupEntry{id: id}
+
+	if s.ttl > 0 {
+		entry.expires = now.Add(s.ttl)
+	}
+
+	if elem, ok := s.entries[id]; ok {
+		elem.Value = entry
+		s.order.MoveToFront(elem)
+	} else {
+		s.entries[id] = s.order.PushFront(entry)
+	}
+
+	for s.order.Len() > 0 {
+		oldest := s.order.Back()
+		if s.order.Len() <= s.capacity && !s.expired(oldest.Value.(*dedupEntry), now) {
+			break
+		}
+
+		s.remove(oldest)
+	}
+
+	return nil
+}
+
+func (s *MemoryDedupStore) expired(entry *dedupEntry, now time.Time) bool {
+	return !entry.expires.IsZero() && now.After(entry.expires)
+}
+
+func (s *MemoryDedupStore) remove(elem *list.Element) {
+	delete(s.entries, elem.Value.(*dedupEntry).id)
+	s.order.Remove(elem)
+}
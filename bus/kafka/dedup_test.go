@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMessageIDKey(t *testing.T) {
+	msg := &Message{Headers: []Header{{Key: HeaderMessageID, Value: []byte("id-1")}}}
+	if id, ok := MessageIDKey(msg); !ok || id != "id-1" {
+		t.Errorf("MessageIDKey() = %q, %v, want id-1, true", id, ok)
+	}
+
+	if _, ok := MessageIDKey(&Message{}); ok {
+		t.Error("MessageIDKey() of a message without ID reported true")
+	}
+}
+
+func TestMemoryDedupStoreCapacity(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryDedupStore(2, 0)
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := s.Mark(ctx, id); err != nil {
+			t.Fatalf("Mark(%q) error = %v", id, err)
+		}
+	}
+
+	for id, want := range map[string]bool{"a": false, "b": true, "c": true, "d": false} {
+		if got, _ := s.Seen(ctx, id); got != want {
+			t.Errorf("Seen(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestMemoryDedupStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryDedupStore(0, time.Millisecond)
+
+	_ = s.Mark(ctx, "a")
+
+	time.Sleep(5 * time.Millisecond)
+
+	if seen, _ := s.Seen(ctx, "a"); seen {
+		t.Error("Seen() reported an expired ID")
+	}
+}
@@ -0,0 +1,208 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+// target is the handler invoked by a dispatcher; either a MessageHandler for
+// each message or a BatchHandler for batches of messages.
+type target struct {
+	handler MessageHandler
+	batch   BatchHandler
+}
+
+// dispatcher routes consumed messages to the MessageHandler, or in batches to the
+// BatchHandler, when the message key matches one of the subscribed events or
+// event patterns, retrying failed messages according to the RetryPolicy.
+// Messages that still fail are routed to the retry topics, then to the
+// dead-letter topic, when configured.
+type dispatcher struct {
+	log          logrus.FieldLogger
+	handler      MessageHandler
+	batchHandler BatchHandler
+	batch        BatchPolicy
+	retry        RetryPolicy
+	dedup        Deduplication
+	watchdog     *watchdog
+	events       *subscriptions
+	retryTopics  *retryTopics
+	deadLetter   *deadLetter
+}
+
+func newDispatcher(opts Options, t target, events ...string) (*dispatcher, error) {
+	if t.handler == nil && t.batch == nil {
+		return nil, errors.ConfigurationError("no handler provided")
+	}
+
+	if len(events) == 0 {
+		return nil, errors.ConfigurationError("no events subscribed")
+	}
+
+	subs, err := newSubscriptions(events...)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.handler != nil {
+		t.handler = Chain(t.handler, opts.Consumer.Middleware...)
+	}
+
+	if t.batch != nil {
+		t.batch = ChainBatch(t.batch, opts.Consumer.BatchMiddleware...)
+	}
+
+	d := &dispatcher{
+		log:          opts.Logger,
+		handler:      t.handler,
+		batchHandler: t.batch,
+		batch:        opts.Consumer.Batch,
+		retry:        opts.Consumer.Retry,
+		dedup:        opts.Consumer.Dedup,
+		watchdog:     &watchdog{HandlerTimeout: opts.Consumer.HandlerTimeout, log: opts.Logger},
+		events:       subs,
+	}
+
+	if len(opts.Consumer.RetryTiers) > 0 {
+		rt, err := newRetryTopics(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		d.retryTopics = rt
+	}
+
+	if opts.Consumer.DeadLetterTopic != "" {
+		dl, err := newDeadLetter(opts)
+		if err != nil {
+			d.close()
+
+			return nil, err
+		}
+
+		d.deadLetter = dl
+	}
+
+	return d, nil
+}
+
+// dispatch invokes the handler for the message if its key was subscribed and
+// it is not a duplicate. It returns nil once the message is handled: the
+// handler succeeded, the message was not subscribed, was a duplicate or it was
+// routed to a retry or the dead-letter topic.
+func (d *dispatcher) dispatch(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	key := string(msg.Key)
+	d.log.Infof("Received message on key: %s", key)
+
+	if !d.events.has(key) {
+		d.log.Debugf("no subscription for key: %s", key)
+
+		return nil
+	}
+
+	d.log.Debugf("invoking handler for message consumed %v with key: %s", msg.Value, key)
+
+	m := newMessage(msg)
+
+	id, duplicate := d.duplicate(ctx, m)
+	if duplicate {
+		return nil
+	}
+
+	attempts, err := d.handle(ctx, m)
+	if err == nil {
+		d.markHandled(ctx, id)
+
+		return nil
+	}
+
+	d.log.WithFields(logrus.Fields{
+		"topic":     msg.Topic,
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+	}).Errorf("handler failed %d time(s) for message with key %s: %v", attempts, key, err)
+
+	return d.routeFailure(ctx, msg, attempts, err)
+}
+
+// dispatchOne dispatches a single message with either handler, reporting
+// whether it was handled.
+func (d *dispatcher) dispatchOne(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	if d.batchHandler != nil {
+		return d.dispatchBatch(ctx, []*sarama.ConsumerMessage{msg})[0]
+	}
+
+	return d.dispatch(ctx, msg) == nil
+}
+
+// routeFailure routes a message that failed every attempt to the next retry
+// topic or, once every retry topic was used, to the dead-letter topic. It
+// returns nil once the message was routed, or the handler error when there is
+// nowhere to route it or routing failed.
+func (d *dispatcher) routeFailure(ctx context.Context, msg *sarama.ConsumerMessage, attempts int, err error) error {
+	// retries were cut short by the consumer stopping, so the message has not
+	// exhausted its attempts and is not routed.
+	if ctx.Err() != nil {
+		return err
+	}
+
+	if d.retryTopics != nil {
+		if tier, ok := d.retryTopics.next(msg.Topic); ok {
+			rterr := d.retryTopics.publish(msg, tier, err)
+			if rterr == nil {
+				return nil
+			}
+
+			d.log.Errorf("error in routing message with key %s to retry topic: %v", msg.Key, rterr)
+		}
+	}
+
+	if d.deadLetter == nil {
+		return err
+	}
+
+	if dlerr := d.deadLetter.publish(msg, attempts, err); dlerr != nil {
+		d.log.Errorf("error in routing message with key %s to dead-letter topic: %v", msg.Key, dlerr)
+
+		return err
+	}
+
+	return nil
+}
+
+// handle invokes the handler, with the request metadata of the message in the
+// context, until it succeeds or the retry policy is exhausted, returning the
+// number of attempts made and the last error.
+func (d *dispatcher) handle(ctx context.Context, msg *Message) (int, error) {
+	ctx = MessageContext(ctx, msg)
+
+	for attempt := 1; ; attempt++ {
+		err := d.watchdog.invoke(ctx, "message with key "+msg.Key, func(ctx context.Context) error {
+			return d.handler(ctx, msg)
+		})
+		if err == nil || attempt >= d.retry.attempts() {
+			return attempt, err
+		}
+
+		d.log.Warnf("attempt %d failed for message with key %s: %v", attempt, msg.Key, err)
+
+		if werr := d.retry.wait(ctx, attempt); werr != nil {
+			return attempt, err
+		}
+	}
+}
+
+// close releases the resources used by the dispatcher.
+func (d *dispatcher) close() {
+	if d.retryTopics != nil {
+		d.retryTopics.close()
+	}
+
+	if d.deadLetter != nil {
+		d.deadLetter.close()
+	}
+}
@@ -0,0 +1,11 @@
+/*
+Package kafka provides an event bus implementation using kafka.
+
+The implementation is a thin wrapper for github.com/Shopify/sarama that handles configuring
+
+	- Consumer
+	- GroupConsumer (uses a consumer group)
+	- Producer (uses a pool)
+	- AsyncProducer
+*/
+package kafka
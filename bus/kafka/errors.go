@@ -0,0 +1,99 @@
+package kafka
+
+import (
+	stderrors "errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrConsumerClosed is returned by Run when the Consumer was closed.
+	ErrConsumerClosed = stderrors.New("consumer is closed")
+	// ErrShutdownTimeout is returned by Run when the messages being handled did
+	// not complete before the shutdown timeout expired.
+	ErrShutdownTimeout = stderrors.New("consumer shutdown timed out before in-flight messages completed")
+	// ErrHandlerPanic is wrapped by the error reported for a message whose
+	// handler panicked, when the Recover or RecoverBatch middleware is used.
+	ErrHandlerPanic = stderrors.New("handler panicked")
+	// ErrHandlerTimeout is wrapped by the error reported for a message whose
+	// handler was abandoned after exceeding its timeout.
+	ErrHandlerTimeout = stderrors.New("handler timed out")
+	// ErrPublishAborted is wrapped by the error returned when the context of a
+	// publish is done before the message was acknowledged.
+	ErrPublishAborted = stderrors.New("publish aborted")
+	// ErrProducerClosed is returned when publishing with a closed AsyncPublisher.
+	ErrProducerClosed = stderrors.New("producer is closed")
+	// ErrFlushTimeout is reported for the messages left unsent once the flush
+	// timeout of a closing AsyncPublisher expired.
+	ErrFlushTimeout = stderrors.New("producer flush timed out")
+)
+
+// ErrorHandler represents a function that is notified of errors encountered by
+// a Consumer while fetching messages, such as broker or offset errors. Errors
+// reported for a specific partition are of type *ConsumerError.
+type ErrorHandler func(error)
+
+// ConsumerError is an error encountered while consuming a partition of a topic.
+type ConsumerError struct {
+	Topic     string
+	Partition int32
+	Err       error
+}
+
+func (e *ConsumerError) Error() string {
+	return fmt.Sprintf("error while consuming %s/%d: %v", e.Topic, e.Partition, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ConsumerError) Unwrap() error {
+	return e.Err
+}
+
+// errorReporter logs the errors of a Consumer and notifies the ErrorHandler.
+type errorReporter struct {
+	log     logrus.FieldLogger
+	handler ErrorHandler
+}
+
+// report logs the error, including the topic and partition when available,
+// and passes it to the ErrorHandler.
+func (r errorReporter) report(err error) {
+	var serr *sarama.ConsumerError
+	if stderrors.As(err, &serr) {
+		err = &ConsumerError{Topic: serr.Topic, Partition: serr.Partition, Err: serr.Err}
+	}
+
+	log := r.log
+	if cerr, ok := err.(*ConsumerError); ok {
+		log = log.WithFields(logrus.Fields{
+			"topic":     cerr.Topic,
+			"partition": cerr.Partition,
+		})
+	}
+
+	log.WithError(err).Error("consumer error")
+
+	if r.handler != nil {
+		r.handler(err)
+	}
+}
+
+// abortedError is returned when the context of a publish is done. It matches
+// both ErrPublishAborted and the context error.
+type abortedError struct {
+	cause error
+}
+
+func (e abortedError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrPublishAborted, e.cause)
+}
+
+func (e abortedError) Is(target error) bool {
+	return target == ErrPublishAborted
+}
+
+func (e abortedError) Unwrap() error {
+	return e.cause
+}
@@ -0,0 +1,556 @@
+package kafka
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+// groupRetryBackoff is the time to wait before re-joining the consumer group
+// after a session ended with an error.
+const groupRetryBackoff = 2 * time.Second
+
+// GroupConsumer provides a Kafka Consumer client that is a member of a consumer
+// group. Partitions of the topics are balanced across all members of the group and
+// the offsets of messages are committed to the group according to the delivery
+// mode; marked offsets are committed on an interval and when a partition is released.
+type GroupConsumer struct {
+	controls
+
+	client    sarama.Client
+	group     sarama.ConsumerGroup
+	groupID   string
+	topics    topicSet
+	refresh   time.Duration
+	start     StartPosition
+	workers   int
+	queueSize int
+	shutdown  time.Duration
+	delivery  DeliveryMode
+	lagReport time.Duration
+	recovery  RecoveryPolicy
+	errors    errorReporter
+	retrier   *retrier
+	life      *lifecycle
+
+	// state of the current Run shared with the group session handlers
+	pool       *workerPool
+	handlerCtx context.Context
+	stopping   <-chan struct{}
+	timedOut   int32
+	// rejoin ends the current group session.
+	rejoin context.CancelFunc
+	// recoveries counts the consecutive attempts to recover a partition.
+	recoveries int32
+
+	// expected holds the offset each claim of the session is expected to start
+	// from, to detect the offsets that were out of range.
+	mu       sync.Mutex
+	expected map[TopicPartition]int64
+}
+
+// NewGroupConsumer creates and configures a new GroupConsumer.
+func NewGroupConsumer(opts Options, h Handler, events ...string) (*GroupConsumer, error) {
+	return NewGroupMessageConsumer(opts, AdaptHandler(h), events...)
+}
+
+// NewGroupMessageConsumer creates and configures a new GroupConsumer that invokes a MessageHandler.
+func NewGroupMessageConsumer(opts Options, h MessageHandler, events ...string) (*GroupConsumer, error) {
+	return newGroupConsumer(opts, target{handler: h}, events...)
+}
+
+// NewGroupBatchConsumer creates and configures a new GroupConsumer that invokes a
+// BatchHandler with batches of messages according to the Batch policy of the
+// options. The offsets of a batch are committed once the batch was handled.
+func NewGroupBatchConsumer(opts Options, h BatchHandler, events ...string) (*GroupConsumer, error) {
+	return newGroupConsumer(opts, target{batch: h}, events...)
+}
+
+func newGroupConsumer(opts Options, t target, events ...string) (*GroupConsumer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.Consumer.GroupID == "" {
+		return nil, errors.ConfigurationError("no consumer group provided")
+	}
+
+	topics, err := newTopicSet(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := newDispatcher(opts, t, events...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &GroupConsumer{
+		topics:    topics,
+		refresh:   opts.Consumer.RefreshFrequency,
+		start:     opts.Consumer.Start,
+		workers:   opts.Consumer.Workers,
+		queueSize: opts.Consumer.QueueSize,
+		shutdown:  opts.Consumer.ShutdownTimeout,
+		delivery:  opts.Consumer.Delivery,
+		controls: controls{
+			log:        opts.Logger.WithField("group", opts.Consumer.GroupID),
+			dispatcher: d,
+			pauser:     newPauser(opts.Logger, opts.Consumer.Backpressure),
+			positions:  newLagTracker(),
+		},
+		lagReport: opts.Consumer.LagInterval,
+		recovery:  opts.Consumer.Recovery,
+		life:      newLifecycle(),
+		groupID:   opts.Consumer.GroupID,
+	}
+
+	if c.refresh <= 0 {
+		c.refresh = defaultRefreshFrequency
+	}
+
+	if c.shutdown <= 0 {
+		c.shutdown = defaultShutdownTimeout
+	}
+
+	c.errors = errorReporter{log: c.log, handler: opts.Consumer.ErrorHandler}
+
+	if err = c.configure(opts); err != nil {
+		opts.Logger.Errorf("error in configuring group consumer: %v", err)
+		d.close()
+
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *GroupConsumer) configure(opts Options) error {
+	config, err := newConsumerConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	c.client, err = sarama.NewClient(opts.Hosts, config)
+	if err != nil {
+		return err
+	}
+
+	c.group, err = sarama.NewConsumerGroupFromClient(opts.Consumer.GroupID, c.client)
+	if err != nil {
+		_ = c.client.Close()
+
+		return err
+	}
+
+	if len(opts.Consumer.RetryTiers) > 0 {
+		if c.retrier, err = newRetrier(opts, c.dispatcher, c.errors); err != nil {
+			_ = c.group.Close()
+			_ = c.client.Close()
+
+			return err
+		}
+	}
+
+	go func() {
+		// closed when the consumer group is closed
+		for gerr := range c.group.Errors() {
+			c.errors.report(gerr)
+		}
+	}()
+
+	return nil
+}
+
+// Close stops the GroupConsumer if it is running and waits for it to drain,
+// then closes resources in use. Closing the group commits any marked offsets
+// and leaves the consumer group so its partitions are re-assigned.
+func (c *GroupConsumer) Close() {
+	if !c.life.close() {
+		return
+	}
+
+	if c.retrier != nil {
+		c.retrier.close()
+	}
+
+	if c.group != nil {
+		if err := c.group.Close(); err != nil {
+			c.log.Errorf("error in closing consumer group: %v", err)
+		}
+	}
+
+	if c.client != nil {
+		_ = c.client.Close()
+	}
+
+	c.dispatcher.close()
+	c.log.Info("consumer has been closed")
+}
+
+// Start will join the consumer group, start listening for messages on the
+// assigned partitions and call the provided handler for any event that was
+// subscribed. The group is re-joined after each rebalance. The channel is
+// used to stop listening for messages.
+func (c *GroupConsumer) Start(stop <-chan bool) {
+	runUntil(stop, c.Run, c.log)
+}
+
+// Run joins the consumer group and handles the messages of the assigned
+// partitions until the context is cancelled or the GroupConsumer is closed.
+// The group is re-joined after each rebalance. When a partition is released,
+// no more messages are read from it and the messages being handled are given
+// up to the shutdown timeout to complete, so their offsets are committed when
+// the session ends; queued messages that were not started are redelivered.
+// Run returns nil when stopped by the context, ErrConsumerClosed when the
+// GroupConsumer was closed and ErrShutdownTimeout when the handlers did not
+// complete in time, in which case their context is cancelled.
+func (c *GroupConsumer) Run(ctx context.Context) error {
+	if err := c.life.begin(); err != nil {
+		return err
+	}
+	defer c.life.end()
+
+	ctx, cancel := c.life.context(ctx)
+	defer cancel()
+
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+
+	c.handlerCtx = handlerCtx
+	c.stopping = ctx.Done()
+	c.pool = newWorkerPool(c.dispatcher, c.workers, c.queueSize)
+	atomic.StoreInt32(&c.timedOut, 0)
+
+	if c.lagReport > 0 {
+		go c.positions.report(ctx, c.lagReport, c.log)
+	}
+
+	retrying := c.retrier.start(ctx, handlerCtx)
+
+	var err error
+
+	for {
+		if cerr := c.consume(ctx); cerr != nil {
+			if stderrors.Is(cerr, sarama.ErrClosedConsumerGroup) {
+				err = ErrConsumerClosed
+
+				break
+			}
+
+			c.errors.report(fmt.Errorf("error in consumer group session: %w", cerr))
+
+			select {
+			case <-time.After(groupRetryBackoff):
+			case <-ctx.Done():
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if !waitDone(retrying, c.shutdown) {
+		cancelHandlers()
+		atomic.StoreInt32(&c.timedOut, 1)
+	}
+
+	if atomic.LoadInt32(&c.timedOut) == 1 {
+		// do not wait on handlers that ignore the cancellation
+		go c.pool.stop()
+
+		return ErrShutdownTimeout
+	}
+
+	c.pool.stop()
+
+	if err == nil && c.life.isClosed() {
+		err = ErrConsumerClosed
+	}
+
+	return err
+}
+
+// consume joins the group for a single session. It blocks for the lifetime of
+// the session and returns when a rebalance happens, the context is cancelled,
+// the group is closed or, when a topic pattern is used, the matching topics changed.
+func (c *GroupConsumer) consume(ctx context.Context) error {
+	topics, err := c.topics.resolve(c.client)
+	if err != nil {
+		return err
+	}
+
+	if len(topics) == 0 {
+		return fmt.Errorf("no topic matches the topic pattern %s", c.topics.pattern)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.rejoin = cancel
+
+	if c.topics.pattern != nil {
+		go c.watchTopics(ctx, cancel, topics)
+	}
+
+	return c.group.Consume(ctx, topics, c)
+}
+
+// watchTopics refreshes the metadata periodically and ends the session when
+// the topics matching the pattern changed, so the group is re-joined with them.
+func (c *GroupConsumer) watchTopics(ctx context.Context, cancel context.CancelFunc, topics []string) {
+	ticker := time.NewTicker(c.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.topics.refresh(c.client); err != nil {
+				c.errors.report(fmt.Errorf("error in refreshing topic metadata: %w", err))
+
+				continue
+			}
+
+			current, err := c.topics.resolve(c.client)
+			if err != nil || reflect.DeepEqual(current, topics) {
+				continue
+			}
+
+			c.log.Infof("topics changed from %v to %v; re-joining the group", topics, current)
+			cancel()
+
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Setup is run at the beginning of a new group session, once partitions have been assigned.
+func (c *GroupConsumer) Setup(session sarama.ConsumerGroupSession) error {
+	c.log.WithField("generation", session.GenerationID()).Infof("partitions assigned: %v", session.Claims())
+
+	committed, err := committedOffsets(c.client, c.groupID, session.Claims())
+	if err != nil {
+		return fmt.Errorf("error in fetching committed offsets: %w", err)
+	}
+
+	for tp, offset := range committed {
+		if offset >= 0 || !c.start.explicit(tp) {
+			continue
+		}
+
+		if committed[tp], err = c.position(session, tp); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.expected = committed
+	c.mu.Unlock()
+
+	return nil
+}
+
+// position applies the start position to a partition that has no offset
+// committed to the group, so it is applied once per group rather than each time
+// the partition is assigned. It returns the offset the partition starts from.
+func (c *GroupConsumer) position(session sarama.ConsumerGroupSession, tp TopicPartition) (int64, error) {
+	offset, err := c.start.offset(c.client, tp)
+	if err != nil {
+		return 0, err
+	}
+
+	if offset, err = c.moveOffset(session, tp, offset); err != nil {
+		return 0, err
+	}
+
+	c.log.Infof("partition %d of topic %s positioned at offset %d", tp.Partition, tp.Topic, offset)
+
+	return offset, nil
+}
+
+// moveOffset marks the offset the partition is read from the next time it is
+// claimed, and returns it.
+func (c *GroupConsumer) moveOffset(session sarama.ConsumerGroupSession, tp TopicPartition, offset int64) (int64, error) {
+	if offset < 0 {
+		// sarama.OffsetNewest or sarama.OffsetOldest (e.g. no message at or after
+		// the timestamp) must be resolved to an actual offset to be committed.
+		var err error
+		if offset, err = c.client.GetOffset(tp.Topic, tp.Partition, offset); err != nil {
+			return 0, err
+		}
+	}
+
+	// ResetOffset only moves the offset backwards and MarkOffset only moves
+	// it forward, so both are needed to position the partition.
+	session.ResetOffset(tp.Topic, tp.Partition, offset, "")
+	session.MarkOffset(tp.Topic, tp.Partition, offset, "")
+
+	return offset, nil
+}
+
+// resetOffset applies the offset reset policy when the offset the claim was
+// expected to start from was out of range, in which case sarama started the
+// claim from the initial offset of the start position instead. Unless the
+// initial offset matches the policy, the claim is not consumed: the partition
+// is either failed or its offset reset and the group re-joined to read it from
+// there. It reports whether the claim can be consumed.
+func (c *GroupConsumer) resetOffset(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, tp TopicPartition) bool {
+	c.mu.Lock()
+	expected, ok := c.expected[tp]
+	c.mu.Unlock()
+
+	if !ok || expected < 0 || claim.InitialOffset() >= 0 {
+		return true
+	}
+
+	reset, ok := c.recovery.OffsetReset.offset()
+	if !ok {
+		c.log.Errorf("offset %d of partition %d of topic %s is out of range; partition will not be consumed", expected, tp.Partition, tp.Topic)
+		c.errors.report(&ConsumerError{Topic: tp.Topic, Partition: tp.Partition, Err: sarama.ErrOffsetOutOfRange})
+
+		return false
+	}
+
+	if reset == claim.InitialOffset() {
+		c.log.Warnf("offset %d of partition %d of topic %s is out of range; consuming from %s", expected, tp.Partition, tp.Topic, c.recovery.OffsetReset)
+
+		return true
+	}
+
+	offset, err := c.moveOffset(session, tp, reset)
+	if err != nil {
+		c.errors.report(&ConsumerError{Topic: tp.Topic, Partition: tp.Partition, Err: err})
+		c.recoverClaim(session, tp)
+
+		return false
+	}
+
+	c.log.Warnf("offset %d of partition %d of topic %s is out of range; re-joining the group to consume from %s at offset %d",
+		expected, tp.Partition, tp.Topic, c.recovery.OffsetReset, offset)
+	c.rejoin()
+
+	return false
+}
+
+// Cleanup is run at the end of a group session, once all ConsumeClaim routines have exited.
+func (c *GroupConsumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	c.log.WithField("generation", session.GenerationID()).Infof("partitions released: %v", session.Claims())
+
+	return nil
+}
+
+// ConsumeClaim dispatches the messages of a single assigned partition and marks
+// their offsets according to the delivery mode. Messages are held while the
+// partition is paused, which stops fetching once the buffer of the claim is
+// full; a held message is redelivered if the partition is released. Before
+// returning, it waits up to the shutdown timeout for the messages of the
+// partition being handled, so their offsets are committed when the session
+// releases the partition.
+func (c *GroupConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx, cancel := context.WithCancel(c.handlerCtx)
+	defer cancel()
+
+	var inflight sync.WaitGroup
+
+	tp := TopicPartition{Topic: claim.Topic(), Partition: claim.Partition()}
+	if !c.resetOffset(session, claim, tp) {
+		return nil
+	}
+
+	c.positions.track(tp, resolveOffset(c.client, tp, claim.InitialOffset()), claim)
+	defer c.positions.untrack(tp, claim)
+
+	skip := make(chan struct{})
+	commits := newCommitter(c.delivery, func(offset int64) {
+		session.MarkOffset(claim.Topic(), claim.Partition(), offset, "")
+	})
+
+	defer func() {
+		close(skip)
+
+		if waitTimeout(&inflight, c.shutdown) {
+			return
+		}
+
+		cancel()
+		c.log.Warnf("in-flight messages of partition %d did not complete within %s", claim.Partition(), c.shutdown)
+
+		select {
+		case <-c.stopping:
+			atomic.StoreInt32(&c.timedOut, 1)
+		default:
+		}
+	}()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				c.recoverClaim(session, tp)
+
+				return nil
+			}
+
+			atomic.StoreInt32(&c.recoveries, 0)
+			c.positions.read(msg)
+
+			if !c.pauser.wait(tp, session.Context().Done()) {
+				return nil
+			}
+
+			inflight.Add(1)
+			c.pauser.acquire()
+
+			commit := commits.receive(msg.Offset)
+			done := func(completed bool) {
+				commit(completed)
+				c.pauser.release()
+				inflight.Done()
+			}
+
+			if err := c.pool.submit(session.Context(), job{ctx: ctx, msg: msg, skip: skip, done: done}); err != nil {
+				c.pauser.release()
+				inflight.Done()
+
+				return nil
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// recoverClaim re-joins the group when the stream of a partition stopped on its
+// own while the session is active (e.g. the offset went out of range), so the
+// partition is re-created. It waits for an exponential backoff growing with the
+// number of consecutive recoveries.
+func (c *GroupConsumer) recoverClaim(session sarama.ConsumerGroupSession, tp TopicPartition) {
+	if session.Context().Err() != nil {
+		return
+	}
+
+	attempt := int(atomic.AddInt32(&c.recoveries, 1))
+	delay := c.recovery.backoff(attempt)
+
+	c.log.Warnf("consumer of partition %d of topic %s stopped; re-joining the group in %s (attempt %d)", tp.Partition, tp.Topic, delay, attempt)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		c.rejoin()
+	case <-session.Context().Done():
+	}
+}
@@ -0,0 +1,192 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// fakeSession records the offsets marked and reset during a group session.
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked map[TopicPartition]int64
+	reset  map[TopicPartition]int64
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{marked: make(map[TopicPartition]int64), reset: make(map[TopicPartition]int64)}
+}
+
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, _ string) {
+	s.marked[TopicPartition{Topic: topic, Partition: partition}] = offset
+}
+
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, _ string) {
+	s.reset[TopicPartition{Topic: topic, Partition: partition}] = offset
+}
+
+func (s *fakeSession) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+
+	return s.ctx
+}
+
+// fakeClaim is a claim started from the initial offset, delivering the
+// messages sent on its messages channel.
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	tp       TopicPartition
+	initial  int64
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string { return c.tp.Topic }
+
+func (c *fakeClaim) Partition() int32 { return c.tp.Partition }
+
+func (c *fakeClaim) InitialOffset() int64 { return c.initial }
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func (c *fakeClaim) HighWaterMarkOffset() int64 { return 0 }
+
+func newOffsetBroker(t *testing.T) (sarama.Client, func()) {
+	t.Helper()
+
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset("events", 0, sarama.OffsetOldest, 10).
+			SetOffset("events", 0, sarama.OffsetNewest, 90),
+	})
+
+	client, err := sarama.NewClient([]string{broker.Addr()}, sarama.NewConfig())
+	if err != nil {
+		broker.Close()
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	return client, func() {
+		_ = client.Close()
+		broker.Close()
+	}
+}
+
+func TestGroupConsumerResetOffset(t *testing.T) {
+	client, closeClient := newOffsetBroker(t)
+	defer closeClient()
+
+	tp := TopicPartition{Topic: "events", Partition: 0}
+
+	tests := []struct {
+		name     string
+		reset    OffsetReset
+		expected int64
+		initial  int64
+		consume  bool
+		moved    int64
+		rejoined bool
+		failed   bool
+	}{
+		{name: "in range", reset: ResetFail, expected: 5, initial: 5, consume: true},
+		{name: "no committed offset", reset: ResetFail, expected: -1, initial: sarama.OffsetNewest, consume: true},
+		{name: "fail", reset: ResetFail, expected: 5, initial: sarama.OffsetNewest, failed: true},
+		{name: "same as initial", reset: ResetNewest, expected: 5, initial: sarama.OffsetNewest, consume: true},
+		{name: "oldest", reset: ResetOldest, expected: 5, initial: sarama.OffsetNewest, moved: 10, rejoined: true},
+		{name: "newest", reset: ResetNewest, expected: 5, initial: sarama.OffsetOldest, moved: 90, rejoined: true},
+	}
+
+	for _, tt := range tests {
+		var reported error
+
+		rejoined := false
+		c := &GroupConsumer{
+			client:   client,
+			recovery: RecoveryPolicy{OffsetReset: tt.reset},
+			controls: controls{log: testLogger()},
+			errors:   errorReporter{log: testLogger(), handler: func(err error) { reported = err }},
+			rejoin:   func() { rejoined = true },
+			expected: map[TopicPartition]int64{tp: tt.expected},
+		}
+		session := newFakeSession()
+
+		if got := c.resetOffset(session, &fakeClaim{tp: tp, initial: tt.initial}, tp); got != tt.consume {
+			t.Errorf("%s: resetOffset() = %v, want %v", tt.name, got, tt.consume)
+		}
+
+		if rejoined != tt.rejoined {
+			t.Errorf("%s: rejoined = %v, want %v", tt.name, rejoined, tt.rejoined)
+		}
+
+		if tt.moved > 0 && (session.reset[tp] != tt.moved || session.marked[tp] != tt.moved) {
+			t.Errorf("%s: offset reset to %d and marked %d, want %d", tt.name, session.reset[tp], session.marked[tp], tt.moved)
+		}
+
+		if failed := errors.Is(reported, sarama.ErrOffsetOutOfRange); failed != tt.failed {
+			t.Errorf("%s: reported %v, want failure %v", tt.name, reported, tt.failed)
+		}
+	}
+}
+
+func TestGroupConsumerConsumeClaimDrain(t *testing.T) {
+	// 0 is the default of Options and 1 the default of the bus configuration
+	for _, workers := range []int{0, 1} {
+		started, release := make(chan struct{}, 1), make(chan struct{})
+
+		var opts Options
+		opts.Consumer.Workers = workers
+
+		d := newTestDispatcher(t, opts, target{handler: blockingHandler(started, release)})
+		stopping := make(chan struct{})
+		close(stopping)
+
+		c := &GroupConsumer{
+			shutdown: 100 * time.Millisecond,
+			controls: controls{
+				log:        testLogger(),
+				dispatcher: d,
+				pauser:     newPauser(testLogger(), Backpressure{}),
+				positions:  newLagTracker(),
+			},
+			handlerCtx: context.Background(),
+			stopping:   stopping,
+			pool:       newWorkerPool(d, workers, 0),
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		session := newFakeSession()
+		session.ctx = ctx
+
+		claim := &fakeClaim{tp: TopicPartition{Topic: "events"}, messages: make(chan *sarama.ConsumerMessage, 1)}
+		claim.messages <- &sarama.ConsumerMessage{Topic: "events", Key: []byte("vm.created")}
+
+		stopped := make(chan error, 1)
+
+		go func() { stopped <- c.ConsumeClaim(session, claim) }()
+
+		<-started
+		cancel()
+
+		select {
+		case <-stopped:
+			if atomic.LoadInt32(&c.timedOut) != 1 {
+				t.Errorf("workers %d: shutdown timeout not reported", workers)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("workers %d: ConsumeClaim() did not return after the shutdown timeout", workers)
+		}
+
+		close(release)
+		c.pool.stop()
+	}
+}
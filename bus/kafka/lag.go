@@ -0,0 +1,148 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// PartitionLag describes how far behind a Consumer is on a partition.
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	// Offset is the offset of the next message the Consumer reads.
+	Offset int64
+	// HighWaterMark is the offset of the next message published to the partition.
+	HighWaterMark int64
+	// Lag is the number of messages published but not read yet.
+	Lag int64
+}
+
+// highWaterMarker is implemented by sarama.PartitionConsumer and
+// sarama.ConsumerGroupClaim.
+type highWaterMarker interface {
+	HighWaterMarkOffset() int64
+}
+
+type partitionPosition struct {
+	offset int64
+	source highWaterMarker
+}
+
+// lagTracker tracks the position of the partitions being read.
+type lagTracker struct {
+	mu         sync.Mutex
+	partitions map[TopicPartition]*partitionPosition
+}
+
+func newLagTracker() *lagTracker {
+	return &lagTracker{partitions: make(map[TopicPartition]*partitionPosition)}
+}
+
+// track starts tracking a partition read from the offset.
+func (t *lagTracker) track(tp TopicPartition, offset int64, source highWaterMarker) {
+	t.mu.Lock()
+	t.partitions[tp] = &partitionPosition{offset: offset, source: source}
+	t.mu.Unlock()
+}
+
+// untrack stops tracking a partition that is no longer read.
+func (t *lagTracker) untrack(tp TopicPartition, source highWaterMarker) {
+	t.mu.Lock()
+	if p, ok := t.partitions[tp]; ok && p.source == source {
+		delete(t.partitions, tp)
+	}
+	t.mu.Unlock()
+}
+
+// read records the message as read from its partition.
+func (t *lagTracker) read(msg *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	if p, ok := t.partitions[TopicPartition{Topic: msg.Topic, Partition: msg.Partition}]; ok {
+		p.offset = msg.Offset + 1
+	}
+	t.mu.Unlock()
+}
+
+// lag returns the lag of every tracked partition, sorted by topic and partition.
+func (t *lagTracker) lag() []PartitionLag {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lags := make([]PartitionLag, 0, len(t.partitions))
+
+	for tp, p := range t.partitions {
+		hwm, offset := p.source.HighWaterMarkOffset(), p.offset
+		if offset < 0 {
+			// the start offset could not be resolved and no message was read yet
+			offset = hwm
+		}
+
+		lag := hwm - offset
+		if lag < 0 {
+			// the high-water mark is not known until the first fetch
+			lag = 0
+		}
+
+		lags = append(lags, PartitionLag{
+			Topic:         tp.Topic,
+			Partition:     tp.Partition,
+			Offset:        offset,
+			HighWaterMark: hwm,
+			Lag:           lag,
+		})
+	}
+
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+
+		return lags[i].Partition < lags[j].Partition
+	})
+
+	return lags
+}
+
+// report logs the lag of every tracked partition on the interval until the
+// context is done.
+func (t *lagTracker) report(ctx context.Context, interval time.Duration, log logrus.FieldLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, l := range t.lag() {
+				log.WithFields(logrus.Fields{
+					"topic":          l.Topic,
+					"partition":      l.Partition,
+					"offset":         l.Offset,
+					"high_watermark": l.HighWaterMark,
+					"lag":            l.Lag,
+				}).Info("consumer lag")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// resolveOffset converts sarama.OffsetNewest or sarama.OffsetOldest into the
+// actual offset of the partition. The offset is returned unchanged when it
+// cannot be resolved.
+func resolveOffset(client sarama.Client, tp TopicPartition, offset int64) int64 {
+	if offset >= 0 {
+		return offset
+	}
+
+	if resolved, err := client.GetOffset(tp.Topic, tp.Partition, offset); err == nil {
+		return resolved
+	}
+
+	return offset
+}
@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+type fakeHighWaterMark int64
+
+func (f fakeHighWaterMark) HighWaterMarkOffset() int64 {
+	return int64(f)
+}
+
+func TestLagTracker(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int64
+		read   []int64
+		hwm    int64
+		want   PartitionLag
+	}{
+		{
+			name:   "behind",
+			offset: 2,
+			hwm:    10,
+			want:   PartitionLag{Offset: 2, HighWaterMark: 10, Lag: 8},
+		},
+		{
+			name:   "read",
+			offset: 2,
+			read:   []int64{2, 3, 4},
+			hwm:    10,
+			want:   PartitionLag{Offset: 5, HighWaterMark: 10, Lag: 5},
+		},
+		{
+			name:   "caught up",
+			offset: 10,
+			hwm:    10,
+			want:   PartitionLag{Offset: 10, HighWaterMark: 10},
+		},
+		{
+			name:   "unresolved offset",
+			offset: sarama.OffsetNewest,
+			hwm:    10,
+			want:   PartitionLag{Offset: 10, HighWaterMark: 10},
+		},
+		{
+			name:   "unknown high-water mark",
+			offset: 2,
+			want:   PartitionLag{Offset: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		tp := TopicPartition{Topic: "events", Partition: 1}
+		tt.want.Topic, tt.want.Partition = tp.Topic, tp.Partition
+
+		tracker := newLagTracker()
+		tracker.track(tp, tt.offset, fakeHighWaterMark(tt.hwm))
+
+		for _, offset := range tt.read {
+			tracker.read(&sarama.ConsumerMessage{Topic: tp.Topic, Partition: tp.Partition, Offset: offset})
+		}
+
+		if got := tracker.lag(); !reflect.DeepEqual(got, []PartitionLag{tt.want}) {
+			t.Errorf("%s: lag() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLagTrackerUntrack(t *testing.T) {
+	tp := TopicPartition{Topic: "events", Partition: 0}
+	old, current := fakeHighWaterMark(1), fakeHighWaterMark(2)
+
+	tracker := newLagTracker()
+	tracker.track(tp, 0, old)
+	tracker.track(tp, 0, current)
+
+	// a partition re-read from another source stays tracked
+	tracker.untrack(tp, old)
+
+	if got := tracker.lag(); len(got) != 1 || got[0].HighWaterMark != 2 {
+		t.Errorf("lag() = %+v after untracking the old source, want the current one", got)
+	}
+
+	tracker.untrack(tp, current)
+
+	if got := tracker.lag(); len(got) != 0 {
+		t.Errorf("lag() = %+v after untracking, want none", got)
+	}
+}
+
+func TestConsumerLag(t *testing.T) {
+	const messages, hwm = 3, 5
+
+	fetch := sarama.NewMockFetchResponse(t, 1).SetVersion(4).SetHighWaterMark("events", 0, hwm)
+	for offset := int64(0); offset < messages; offset++ {
+		fetch.SetMessage("events", 0, offset, sarama.StringEncoder("{}"))
+	}
+
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset("events", 0, sarama.OffsetOldest, 0).
+			SetOffset("events", 0, sarama.OffsetNewest, hwm),
+		"FetchRequest": fetch,
+	})
+
+	handled := make(chan int64, messages)
+
+	c := newBrokerConsumer(t, broker, Options{}, func(_ context.Context, msg *Message) error {
+		handled <- msg.Offset
+
+		return nil
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = c.Run(ctx) }()
+
+	for i := 0; i < messages; i++ {
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d message(s) handled, want %d", i, messages)
+		}
+	}
+
+	want := []PartitionLag{{Topic: "events", Partition: 0, Offset: messages, HighWaterMark: hwm, Lag: hwm - messages}}
+
+	var got []PartitionLag
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if got = c.Lag(); reflect.DeepEqual(got, want) {
+			return
+		}
+	}
+
+	t.Errorf("Lag() = %+v, want %+v", got, want)
+}
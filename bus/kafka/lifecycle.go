@@ -0,0 +1,138 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultShutdownTimeout is how long a stopping Consumer waits for the messages
+// being handled to complete.
+const defaultShutdownTimeout = 30 * time.Second
+
+// lifecycle coordinates running a Consumer with closing it, so Close stops a
+// running Consumer and waits for it to drain before releasing resources.
+type lifecycle struct {
+	mu      sync.Mutex
+	closed  bool
+	done    chan struct{}
+	running sync.WaitGroup
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{done: make(chan struct{})}
+}
+
+// begin registers a running Consumer, it fails once the Consumer is closed.
+// Each successful begin must be followed by a call to end.
+func (l *lifecycle) begin() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrConsumerClosed
+	}
+
+	l.running.Add(1)
+
+	return nil
+}
+
+func (l *lifecycle) end() {
+	l.running.Done()
+}
+
+// close signals the running Consumer to stop and waits for it to return. It
+// reports false when the Consumer was already closed.
+func (l *lifecycle) close() bool {
+	l.mu.Lock()
+
+	if l.closed {
+		l.mu.Unlock()
+
+		return false
+	}
+
+	l.closed = true
+	close(l.done)
+	l.mu.Unlock()
+
+	l.running.Wait()
+
+	return true
+}
+
+// isClosed reports whether the Consumer was closed.
+func (l *lifecycle) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.closed
+}
+
+// context returns a context that is cancelled with the parent or when the
+// Consumer is closed.
+func (l *lifecycle) context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	go func() {
+		select {
+		case <-l.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// waitTimeout waits for the WaitGroup and reports false if the timeout expired first.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return waitDone(done, timeout)
+}
+
+// waitDone waits for the channel to be closed and reports false when the
+// timeout expired first.
+func waitDone(done <-chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// runUntil runs the Consumer until a value is received on or the stop channel
+// is closed; it backs the Start method of the Consumers.
+func runUntil(stop <-chan bool, run func(context.Context) error, log logrus.FieldLogger) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := run(ctx); err != nil {
+		log.Errorf("consumer has stopped: %v", err)
+
+		return
+	}
+
+	log.Info("consumer has stopped as requested")
+}
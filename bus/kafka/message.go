@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Handler represents a generic function that accepts a message key
+// and byte array containing the received message, and handles the message.
+type Handler func(string, []byte)
+
+// MessageHandler represents a function that handles a consumed Message. The
+// context carries the request metadata of the message and is cancelled when the
+// Consumer is stopped. Returning an error reports the message as failed so the
+// Consumer can retry it.
+type MessageHandler func(context.Context, *Message) error
+
+// Message is a message consumed from the bus, along with its metadata.
+type Message struct {
+	// Topic, Partition and Offset locate the message where it was consumed
+	// from. For a message redelivered from a retry topic, they locate it where
+	// it was originally consumed from.
+	Topic     string
+	Partition int32
+	Offset    int64
+	// Timestamp is the time the message was published, or appended to the log
+	// depending on the topic configuration.
+	Timestamp time.Time
+	Headers   []Header
+	Key       string
+	Value     []byte
+}
+
+// Header is a key/value pair attached to a message.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Header returns the value of the first header with the given key, and reports
+// whether the header was found.
+func (m *Message) Header(key string) ([]byte, bool) {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// AdaptHandler converts a Handler into a MessageHandler. The resulting
+// MessageHandler never reports a failure.
+func AdaptHandler(h Handler) MessageHandler {
+	if h == nil {
+		return nil
+	}
+
+	return func(_ context.Context, msg *Message) error {
+		h(msg.Key, msg.Value)
+
+		return nil
+	}
+}
+
+func newMessage(msg *sarama.ConsumerMessage) *Message {
+	headers := make([]Header, 0, len(msg.Headers))
+
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers = append(headers, Header{Key: string(h.Key), Value: h.Value})
+		}
+	}
+
+	src := origin(msg)
+
+	return &Message{
+		Topic:     src.topic,
+		Partition: src.partition,
+		Offset:    src.offset,
+		Timestamp: msg.Timestamp,
+		Headers:   headers,
+		Key:       string(msg.Key),
+		Value:     msg.Value,
+	}
+}
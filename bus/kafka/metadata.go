@@ -0,0 +1,131 @@
+package kafka
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-openapi/strfmt"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+	"gitscm.cisco.com/mcmp/utils/ctxutil"
+)
+
+// Headers carrying the request metadata of the publishing context, as set with
+// the ctxutil package. The token is never written to a message.
+const (
+	HeaderRequestID      = "bus-request-id"
+	HeaderTenantID       = "bus-tenant-id"
+	HeaderAccountID      = "bus-account-id"
+	HeaderServiceGroupID = "bus-service-group-id"
+	HeaderEnterpriseID   = "bus-enterprise-id"
+	HeaderPrincipal      = "bus-principal"
+	HeaderClientID       = "bus-client-id"
+)
+
+// metadataField maps a ctxutil value to the header carrying it.
+type metadataField struct {
+	header string
+	get    func(context.Context) string
+	with   func(context.Context, string) context.Context
+}
+
+var metadataFields = []metadataField{
+	{
+		header: HeaderRequestID,
+		get:    func(ctx context.Context) string { return ctxutil.RequestID(ctx).String() },
+		with: func(ctx context.Context, v string) context.Context {
+			return ctxutil.WithRequestID(ctx, strfmt.UUID(v))
+		},
+	},
+	{
+		header: HeaderTenantID,
+		get:    func(ctx context.Context) string { return ctxutil.TenantID(ctx).String() },
+		with: func(ctx context.Context, v string) context.Context {
+			return ctxutil.WithTenantID(ctx, strfmt.UUID(v))
+		},
+	},
+	{
+		header: HeaderAccountID,
+		get:    func(ctx context.Context) string { return ctxutil.AccountID(ctx).String() },
+		with: func(ctx context.Context, v string) context.Context {
+			return ctxutil.WithAccountID(ctx, strfmt.UUID(v))
+		},
+	},
+	{
+		header: HeaderServiceGroupID,
+		get:    func(ctx context.Context) string { return ctxutil.ServiceGroupID(ctx).String() },
+		with: func(ctx context.Context, v string) context.Context {
+			return ctxutil.WithServiceGroupID(ctx, strfmt.UUID(v))
+		},
+	},
+	{
+		header: HeaderEnterpriseID,
+		get:    func(ctx context.Context) string { return ctxutil.EnterpriseID(ctx).String() },
+		with: func(ctx context.Context, v string) context.Context {
+			return ctxutil.WithEnterpriseID(ctx, strfmt.UUID(v))
+		},
+	},
+	{
+		header: HeaderPrincipal,
+		get:    ctxutil.Principal,
+		with:   ctxutil.WithPrincipal,
+	},
+	{
+		header: HeaderClientID,
+		get:    ctxutil.ClientID,
+		with:   ctxutil.WithClientID,
+	},
+}
+
+// contextHeaders returns the headers carrying the request metadata found in the
+// context; values that are not set are omitted.
+func contextHeaders(ctx context.Context) []sarama.RecordHeader {
+	var headers []sarama.RecordHeader
+
+	for _, f := range metadataFields {
+		if v := f.get(ctx); v != "" {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(f.header), Value: []byte(v)})
+		}
+	}
+
+	return headers
+}
+
+// MessageContext returns a copy of the context carrying the request metadata
+// found in the headers of the message, so that log.Logger reports the same
+// CorrelationId as the publishing service. MessageHandlers are invoked with such
+// a context; a BatchHandler uses it to handle each message of a batch.
+func MessageContext(ctx context.Context, msg *Message) context.Context {
+	for _, f := range metadataFields {
+		if v, ok := msg.Header(f.header); ok && len(v) > 0 {
+			ctx = f.with(ctx, string(v))
+		}
+	}
+
+	return ctx
+}
+
+// minHeadersVersion is the first Kafka version supporting message headers.
+var minHeadersVersion = sarama.V0_11_0_0
+
+// ParseKafkaVersion converts a Kafka version such as "2.1.0" into the protocol
+// version used to talk to the brokers. An empty value is the same as the sarama
+// default version. Versions that do not support message headers are rejected.
+func ParseKafkaVersion(val string) (sarama.KafkaVersion, error) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return sarama.DefaultVersion, nil
+	}
+
+	version, err := sarama.ParseKafkaVersion(val)
+	if err != nil {
+		return sarama.DefaultVersion, errors.ConfigurationError("invalid kafka version: " + val)
+	}
+
+	if !version.IsAtLeast(minHeadersVersion) {
+		return sarama.DefaultVersion, errors.ConfigurationError("kafka version does not support message headers: " + val)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-openapi/strfmt"
+
+	"gitscm.cisco.com/mcmp/utils/ctxutil"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	requestID := strfmt.UUID("0b7c2d2e-6f3a-4c1e-9a55-2d0d1e4f8a10")
+
+	ctx := ctxutil.WithRequestID(context.Background(), requestID)
+	ctx = ctxutil.WithPrincipal(ctx, "alice")
+
+	headers := contextHeaders(ctx)
+	if len(headers) != 2 {
+		t.Fatalf("contextHeaders() = %d header(s), want 2", len(headers))
+	}
+
+	msg := newMessage(&sarama.ConsumerMessage{Headers: recordHeaders(headers)})
+	got := MessageContext(context.Background(), msg)
+
+	if id := ctxutil.RequestID(got); id != requestID {
+		t.Errorf("RequestID = %s, want %s", id, requestID)
+	}
+
+	if p := ctxutil.Principal(got); p != "alice" {
+		t.Errorf("Principal = %s, want alice", p)
+	}
+}
+
+func TestParseKafkaVersion(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    sarama.KafkaVersion
+		wantErr bool
+	}{
+		{val: "", want: sarama.DefaultVersion},
+		{val: "2.1.0", want: sarama.V2_1_0_0},
+		{val: "0.10.2.0", wantErr: true},
+		{val: "latest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseKafkaVersion(tt.val)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseKafkaVersion(%q) error = %v, wantErr %v", tt.val, err, tt.wantErr)
+
+			continue
+		}
+
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseKafkaVersion(%q) = %s, want %s", tt.val, got, tt.want)
+		}
+	}
+}
+
+// recordHeaders converts produced headers into consumed ones.
+func recordHeaders(headers []sarama.RecordHeader) []*sarama.RecordHeader {
+	out := make([]*sarama.RecordHeader, len(headers))
+	for i := range headers {
+		out[i] = &headers[i]
+	}
+
+	return out
+}
@@ -0,0 +1,149 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Middleware wraps a MessageHandler to add behavior around the handling of
+// each message, such as logging or metrics.
+type Middleware func(MessageHandler) MessageHandler
+
+// BatchMiddleware wraps a BatchHandler to add behavior around the handling of
+// each batch.
+type BatchMiddleware func(BatchHandler) BatchHandler
+
+// MetricsRecorder records the outcome of handling each message.
+type MetricsRecorder interface {
+	// ObserveMessage is called once the message was handled, with the time
+	// taken by the handler and the error it returned, if any.
+	ObserveMessage(msg *Message, duration time.Duration, err error)
+}
+
+// Chain wraps the handler with the middlewares. The first middleware is the
+// outermost, so it is the first to see each message.
+func Chain(h MessageHandler, middlewares ...Middleware) MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			h = middlewares[i](h)
+		}
+	}
+
+	return h
+}
+
+// ChainBatch wraps the batch handler with the middlewares. The first middleware
+// is the outermost, so it is the first to see each batch.
+func ChainBatch(h BatchHandler, middlewares ...BatchMiddleware) BatchHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			h = middlewares[i](h)
+		}
+	}
+
+	return h
+}
+
+// Recover returns a Middleware that recovers from a panic in the handler, logs
+// it along with the stack trace and reports the message as failed with an
+// error wrapping ErrHandlerPanic.
+func Recover(log logrus.FieldLogger) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					messageLogger(log, msg).Errorf("handler panicked for message with key %s: %v\n%s", msg.Key, r, debug.Stack())
+					err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+				}
+			}()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// RecoverBatch returns a BatchMiddleware that recovers from a panic in the batch
+// handler, logs it along with the stack trace and reports the whole batch as
+// failed with an error wrapping ErrHandlerPanic.
+func RecoverBatch(log logrus.FieldLogger) BatchMiddleware {
+	return func(next BatchHandler) BatchHandler {
+		return func(ctx context.Context, msgs []*Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("batch handler panicked for batch of %d message(s): %v\n%s", len(msgs), r, debug.Stack())
+					err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+				}
+			}()
+
+			return next(ctx, msgs)
+		}
+	}
+}
+
+// Logging returns a Middleware that logs each message handled along with the
+// outcome.
+func Logging(log logrus.FieldLogger) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *Message) error {
+			l := messageLogger(log, msg)
+			l.Debugf("handling message with key %s", msg.Key)
+
+			err := next(ctx, msg)
+			if err != nil {
+				l.Warnf("failed to handle message with key %s: %v", msg.Key, err)
+			} else {
+				l.Infof("handled message with key %s", msg.Key)
+			}
+
+			return err
+		}
+	}
+}
+
+// Timing returns a Middleware that logs how long each message took to handle.
+// Messages that took longer than the slow threshold are logged as warnings,
+// unless the threshold is zero.
+func Timing(log logrus.FieldLogger, slow time.Duration) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			elapsed := time.Since(start)
+
+			l := messageLogger(log, msg).WithField("duration", elapsed)
+			if slow > 0 && elapsed > slow {
+				l.Warnf("message with key %s took %s to handle", msg.Key, elapsed)
+			} else {
+				l.Debugf("message with key %s took %s to handle", msg.Key, elapsed)
+			}
+
+			return err
+		}
+	}
+}
+
+// Metrics returns a Middleware that records the duration and outcome of each
+// message with the MetricsRecorder.
+func Metrics(recorder MetricsRecorder) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			recorder.ObserveMessage(msg, time.Since(start), err)
+
+			return err
+		}
+	}
+}
+
+func messageLogger(log logrus.FieldLogger, msg *Message) logrus.FieldLogger {
+	return log.WithFields(logrus.Fields{
+		"topic":     msg.Topic,
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+	})
+}
@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// testLogger returns a logger discarding its output.
+func testLogger() logrus.FieldLogger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	return log
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+
+	trace := func(name string) Middleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx context.Context, msg *Message) error {
+				calls = append(calls, name)
+
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	h := Chain(func(context.Context, *Message) error {
+		calls = append(calls, "handler")
+
+		return nil
+	}, trace("outer"), nil, trace("inner"))
+
+	if err := h(context.Background(), &Message{}); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+
+	if got := strings.Join(calls, ","); got != "outer,inner,handler" {
+		t.Errorf("calls = %s, want outer,inner,handler", got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	h := Recover(testLogger())(func(context.Context, *Message) error {
+		panic("boom")
+	})
+
+	err := h(context.Background(), &Message{Key: "vm.created"})
+	if !errors.Is(err, ErrHandlerPanic) {
+		t.Fatalf("error = %v, want %v", err, ErrHandlerPanic)
+	}
+}
+
+type recordedObservation struct {
+	msg *Message
+	err error
+}
+
+type metricsRecorderFunc func(*Message, time.Duration, error)
+
+func (f metricsRecorderFunc) ObserveMessage(msg *Message, d time.Duration, err error) {
+	f(msg, d, err)
+}
+
+func TestMetrics(t *testing.T) {
+	var observed []recordedObservation
+
+	recorder := metricsRecorderFunc(func(msg *Message, _ time.Duration, err error) {
+		observed = append(observed, recordedObservation{msg: msg, err: err})
+	})
+
+	failure := errors.New("failure")
+	msg := &Message{Key: "vm.created"}
+
+	h := Metrics(recorder)(func(context.Context, *Message) error { return failure })
+	_ = h(context.Background(), msg)
+
+	if len(observed) != 1 || observed[0].msg != msg || !errors.Is(observed[0].err, failure) {
+		t.Fatalf("observed %+v, want the message and its error", observed)
+	}
+}
+
+func TestChainBatchRecover(t *testing.T) {
+	var seen int
+
+	count := func(next BatchHandler) BatchHandler {
+		return func(ctx context.Context, msgs []*Message) error {
+			seen += len(msgs)
+
+			return next(ctx, msgs)
+		}
+	}
+
+	h := ChainBatch(func(context.Context, []*Message) error {
+		panic("boom")
+	}, RecoverBatch(testLogger()), count)
+
+	err := h(context.Background(), []*Message{{}, {}})
+	if !errors.Is(err, ErrHandlerPanic) {
+		t.Fatalf("error = %v, want %v", err, ErrHandlerPanic)
+	}
+
+	if seen != 2 {
+		t.Errorf("middleware saw %d message(s), want 2", seen)
+	}
+}
+
+func TestDispatcherBatchMiddleware(t *testing.T) {
+	opts := Options{Logger: testLogger()}
+	opts.Consumer.BatchMiddleware = []BatchMiddleware{RecoverBatch(opts.Logger)}
+
+	d := newTestDispatcher(t, opts, target{batch: func(context.Context, []*Message) error {
+		panic("boom")
+	}})
+
+	handled := d.dispatchBatch(context.Background(), []*sarama.ConsumerMessage{{Key: []byte("vm.created")}})
+	if handled[0] {
+		t.Error("message of a panicking batch handler reported as handled")
+	}
+}
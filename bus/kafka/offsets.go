@@ -0,0 +1,139 @@
+package kafka
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+// StartFrom identifies where a Consumer starts reading a partition when no
+// explicit offset was provided for it.
+type StartFrom int
+
+const (
+	// StartNewest starts reading with the next message published to the partition.
+	StartNewest StartFrom = iota
+	// StartOldest starts reading with the oldest message retained by the partition.
+	StartOldest
+	// StartTimestamp starts reading with the first message published at or after
+	// StartPosition.Time.
+	StartTimestamp
+)
+
+// StartPosition defines where a Consumer starts reading each partition.
+type StartPosition struct {
+	// From is used for any partition that is not listed in Offsets.
+	From StartFrom
+	// Time is the wall-clock time to start from when From is StartTimestamp.
+	Time time.Time
+	// Offsets defines an explicit offset to start from for each partition of
+	// a topic. Like the other positions, it only applies to a partition that
+	// has no offset committed to the consumer group; rewinding a consumer
+	// group requires resetting its offsets or using a new group.
+	Offsets map[TopicPartition]int64
+}
+
+// ParseStartPosition converts the value "newest", "oldest" or an RFC3339
+// timestamp into a StartPosition. An empty value is the same as "newest".
+func ParseStartPosition(val string) (StartPosition, error) {
+	v := strings.TrimSpace(val)
+
+	switch strings.ToLower(v) {
+	case "", "newest":
+		return StartPosition{From: StartNewest}, nil
+	case "oldest":
+		return StartPosition{From: StartOldest}, nil
+	default:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return StartPosition{}, errors.ConfigurationError("invalid start position: " + val)
+		}
+
+		return StartPosition{From: StartTimestamp, Time: t}, nil
+	}
+}
+
+// initial returns the sarama offset used when a partition has no explicit or
+// committed offset.
+func (s StartPosition) initial() int64 {
+	if s.From == StartOldest {
+		return sarama.OffsetOldest
+	}
+
+	return sarama.OffsetNewest
+}
+
+// explicit reports whether the partition has a position other than the initial
+// offset, either an explicit offset or a timestamp. It only applies to
+// partitions without a committed offset.
+func (s StartPosition) explicit(tp TopicPartition) bool {
+	_, ok := s.Offsets[tp]
+
+	return ok || s.From == StartTimestamp
+}
+
+// offset resolves the offset to start reading the partition from. Timestamps are
+// resolved using the broker, which returns the offset of the first message
+// published at or after the time, or sarama.OffsetNewest when there is none.
+func (s StartPosition) offset(client sarama.Client, tp TopicPartition) (int64, error) {
+	if offset, ok := s.Offsets[tp]; ok {
+		return offset, nil
+	}
+
+	if s.From == StartTimestamp {
+		return client.GetOffset(tp.Topic, tp.Partition, s.Time.UnixNano()/int64(time.Millisecond))
+	}
+
+	return s.initial(), nil
+}
+
+// committedOffsets fetches the offsets committed by the consumer group for the
+// claimed partitions. A partition without a committed offset maps to a negative
+// offset.
+func committedOffsets(client sarama.Client, group string, claims map[string][]int32) (map[TopicPartition]int64, error) {
+	offsets := make(map[TopicPartition]int64)
+	if len(claims) == 0 {
+		return offsets, nil
+	}
+
+	req := &sarama.OffsetFetchRequest{Version: 1, ConsumerGroup: group}
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			req.AddPartition(topic, partition)
+		}
+	}
+
+	broker, err := client.Coordinator(group)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := broker.FetchOffset(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			block := resp.GetBlock(topic, partition)
+			if block == nil {
+				return nil, sarama.ErrIncompleteResponse
+			}
+
+			if block.Err != sarama.ErrNoError {
+				if block.Err == sarama.ErrNotCoordinatorForConsumer {
+					_ = client.RefreshCoordinator(group)
+				}
+
+				return nil, block.Err
+			}
+
+			offsets[TopicPartition{Topic: topic, Partition: partition}] = block.Offset
+		}
+	}
+
+	return offsets, nil
+}
@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestParseStartPosition(t *testing.T) {
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		val     string
+		want    StartPosition
+		wantErr bool
+	}{
+		{val: "", want: StartPosition{From: StartNewest}},
+		{val: "Newest", want: StartPosition{From: StartNewest}},
+		{val: " oldest ", want: StartPosition{From: StartOldest}},
+		{val: "2021-03-04T05:06:07Z", want: StartPosition{From: StartTimestamp, Time: ts}},
+		{val: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseStartPosition(tt.val)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseStartPosition(%q) error = %v, wantErr %v", tt.val, err, tt.wantErr)
+
+			continue
+		}
+
+		if got.From != tt.want.From || !got.Time.Equal(tt.want.Time) {
+			t.Errorf("ParseStartPosition(%q) = %+v, want %+v", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestStartPositionExplicit(t *testing.T) {
+	tp := TopicPartition{Topic: "events", Partition: 1}
+	s := StartPosition{From: StartOldest, Offsets: map[TopicPartition]int64{tp: 42}}
+
+	if !s.explicit(tp) {
+		t.Error("partition with an explicit offset is not explicit")
+	}
+
+	if s.explicit(TopicPartition{Topic: "audit", Partition: 1}) {
+		t.Error("same partition of another topic is explicit")
+	}
+
+	if !(StartPosition{From: StartTimestamp}).explicit(tp) {
+		t.Error("timestamp position is not explicit")
+	}
+}
+
+func TestCommittedOffsets(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()).
+			SetLeader("events", 1, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("group", "events", 0, 42, "", sarama.ErrNoError).
+			SetOffset("group", "events", 1, -1, "", sarama.ErrNoError),
+	})
+
+	client, err := sarama.NewClient([]string{broker.Addr()}, sarama.NewConfig())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	got, err := committedOffsets(client, "group", map[string][]int32{"events": {0, 1}})
+	if err != nil {
+		t.Fatalf("committedOffsets() error = %v", err)
+	}
+
+	want := map[TopicPartition]int64{{Topic: "events", Partition: 0}: 42, {Topic: "events", Partition: 1}: -1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("committedOffsets() = %v, want %v", got, want)
+	}
+
+	if _, err = committedOffsets(client, "group", map[string][]int32{"events": {2}}); err == nil {
+		t.Error("committedOffsets() of a partition missing from the response succeeded")
+	}
+}
+
+func TestStartPositionOffset(t *testing.T) {
+	s := StartPosition{From: StartOldest, Offsets: map[TopicPartition]int64{{Topic: "events", Partition: 1}: 42}}
+
+	for tp, want := range map[TopicPartition]int64{
+		{Topic: "events", Partition: 1}: 42,
+		{Topic: "audit", Partition: 1}:  sarama.OffsetOldest,
+	} {
+		got, err := s.offset(nil, tp)
+		if err != nil || got != want {
+			t.Errorf("offset(%v) = %d, %v, want %d", tp, got, err, want)
+		}
+	}
+}
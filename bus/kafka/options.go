@@ -0,0 +1,150 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+// Options is used runtime to send the needed config params.
+type Options struct {
+	Logger logrus.FieldLogger
+	Hosts  []string
+	Topic  string
+	// Version is the Kafka protocol version used to talk to the brokers. It must
+	// support message headers, i.e. 0.11.0 or later; defaults to the sarama
+	// default version when not set.
+	Version  sarama.KafkaVersion
+	Producer struct {
+		InitCapacity int
+		MaxCapacity  int
+		// BufferSize is the number of messages an AsyncPublisher holds until
+		// they are acknowledged; publishing blocks once it is full. Defaults
+		// to 256.
+		BufferSize int
+		// FlushTimeout is how long a closing AsyncPublisher waits for the
+		// messages it holds to be sent. Defaults to 10 seconds.
+		FlushTimeout time.Duration
+	}
+	Consumer struct {
+		// GroupID identifies the consumer group used to coordinate partition
+		// assignment and committed offsets across consumer instances.
+		GroupID string
+		// Topics are the topics read by the Consumer, instead of Topic.
+		Topics []string
+		// TopicPattern is a regular expression; the Consumer also reads every
+		// topic whose name matches it, including topics created while running.
+		TopicPattern string
+		// RefreshFrequency is how often the topic metadata is refreshed to
+		// discover new partitions. Defaults to one minute.
+		RefreshFrequency time.Duration
+		// Recovery defines how a partition whose stream stopped is re-created,
+		// and what happens when its offset is out of range. A GroupConsumer
+		// re-joins the group to recover a partition, and to read it from the
+		// offset of the OffsetReset policy when its committed offset is out of
+		// range.
+		Recovery RecoveryPolicy
+		// Start defines where reading starts for each partition. Consumer groups
+		// resume from the committed offset; the start position only applies to
+		// the partitions without a committed offset.
+		Start StartPosition
+		// HandlerTimeout limits the time each handler attempt may take. Handlers
+		// exceeding it are logged and counted, and optionally abandoned.
+		HandlerTimeout HandlerTimeout
+		// Middleware wraps the MessageHandler, the first middleware being the
+		// outermost. It is not applied to a BatchHandler.
+		Middleware []Middleware
+		// BatchMiddleware wraps the BatchHandler, the first middleware being
+		// the outermost.
+		BatchMiddleware []BatchMiddleware
+		// Retry defines how messages are retried when a MessageHandler fails.
+		Retry RetryPolicy
+		// Dedup skips messages that were already handled, as identified by the
+		// HeaderMessageID header or a DedupKeyFunc. Disabled when no store is set.
+		Dedup Deduplication
+		// RetryTiers are topics that messages are routed to, in order, once the
+		// MessageHandler failed every attempt, so they are retried after a delay
+		// without holding back the other messages. Messages that failed every
+		// retry topic are routed to the DeadLetterTopic. Requires a GroupID.
+		RetryTiers []RetryTier
+		// DeadLetterTopic is the topic that messages are routed to once the
+		// MessageHandler failed every attempt. No dead-letter topic is used when empty.
+		DeadLetterTopic string
+		// ErrorHandler is notified of the errors encountered while consuming,
+		// in addition to the errors being logged.
+		ErrorHandler ErrorHandler
+		// Workers is the number of messages handled concurrently. Messages with
+		// the same key are always handled in order by the same worker. Messages
+		// are handled one at a time when less than two workers are configured.
+		Workers int
+		// QueueSize is the number of messages each worker can hold before the
+		// Consumer stops reading new messages. Defaults to 100.
+		QueueSize int
+		// ShutdownTimeout is how long a stopping Consumer waits for the messages
+		// being handled to complete. Defaults to 30 seconds.
+		ShutdownTimeout time.Duration
+		// Delivery defines when the offset of a message is committed, either
+		// after it was completed (AtLeastOnce) or when it is received (AtMostOnce).
+		Delivery DeliveryMode
+		// CommitInterval is how often the marked offsets are committed to the
+		// consumer group; they are also committed when the Consumer stops.
+		// Defaults to one second.
+		CommitInterval time.Duration
+		// LagInterval is how often the offset, high-water mark and lag of each
+		// partition is logged. No lag is logged when zero.
+		LagInterval time.Duration
+		// Batch defines how messages are grouped when they are handled by a
+		// BatchHandler.
+		Batch BatchPolicy
+		// Backpressure pauses reading once too many messages are being handled
+		// or queued on the workers. Disabled when HighWaterMark is zero.
+		Backpressure Backpressure
+	}
+}
+
+// Validate verifies the values provided for Options are valid.
+func (o Options) Validate() error {
+	if len(o.Hosts) == 0 || o.Hosts[0] == "" {
+		return errors.ConfigurationError("no host(s) provided")
+	}
+
+	if o.Topic == "" && len(o.Consumer.Topics) == 0 && o.Consumer.TopicPattern == "" {
+		return errors.ConfigurationError("no topic provided")
+	}
+
+	if o.Version != (sarama.KafkaVersion{}) && !o.Version.IsAtLeast(minHeadersVersion) {
+		return errors.ConfigurationError("kafka version does not support message headers: " + o.Version.String())
+	}
+
+	if len(o.Consumer.RetryTiers) > 0 && o.Consumer.GroupID == "" {
+		return errors.ConfigurationError("retry topics require a consumer group")
+	}
+
+	for _, tier := range o.Consumer.RetryTiers {
+		if tier.Topic == "" || tier.Delay < 0 {
+			return errors.ConfigurationError("invalid retry topic: " + tier.Topic)
+		}
+	}
+
+	if bp := o.Consumer.Backpressure; bp.HighWaterMark > 0 && bp.LowWaterMark >= bp.HighWaterMark {
+		return errors.ConfigurationError("backpressure low-water mark must be lower than the high-water mark")
+	}
+
+	if o.Logger == nil {
+		return errors.ConfigurationError("no logger provided")
+	}
+
+	return nil
+}
+
+// kafkaVersion returns the protocol version used to talk to the brokers.
+func (o Options) kafkaVersion() sarama.KafkaVersion {
+	if o.Version == (sarama.KafkaVersion{}) {
+		return sarama.DefaultVersion
+	}
+
+	return o.Version
+}
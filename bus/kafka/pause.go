@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Backpressure defines when a Consumer automatically pauses reading messages
+// based on the number of messages being handled or queued on the workers.
+// Reading pauses once HighWaterMark messages are in flight and resumes once
+// they dropped to LowWaterMark. Automatic pausing is disabled when
+// HighWaterMark is zero.
+type Backpressure struct {
+	HighWaterMark int
+	LowWaterMark  int
+}
+
+// pauser tracks the paused partitions of a Consumer. Partitions are paused
+// explicitly, all at once or individually, or automatically while the number
+// of in-flight messages is above the high-water mark.
+type pauser struct {
+	log          logrus.FieldLogger
+	backpressure Backpressure
+
+	mu         sync.Mutex
+	all        bool
+	partitions map[TopicPartition]bool
+	// resumed holds the partitions resumed individually while all are paused.
+	resumed   map[TopicPartition]bool
+	inflight  int
+	throttled bool
+	// changed is closed and replaced each time the paused state changes.
+	changed chan struct{}
+}
+
+func newPauser(log logrus.FieldLogger, backpressure Backpressure) *pauser {
+	return &pauser{
+		log:          log,
+		backpressure: backpressure,
+		partitions:   make(map[TopicPartition]bool),
+		resumed:      make(map[TopicPartition]bool),
+		changed:      make(chan struct{}),
+	}
+}
+
+// pause pauses the partitions, or every partition when none is given.
+func (p *pauser) pause(partitions ...TopicPartition) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(partitions) == 0 {
+		p.all = true
+		p.resumed = make(map[TopicPartition]bool)
+	}
+
+	for _, tp := range partitions {
+		p.partitions[tp] = true
+		delete(p.resumed, tp)
+	}
+
+	p.notify()
+}
+
+// resume resumes the partitions, or every partition when none is given. A
+// partition resumed while every partition is paused is the only one resumed. A
+// partition stays paused while the Consumer is throttled by backpressure.
+func (p *pauser) resume(partitions ...TopicPartition) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(partitions) == 0 {
+		p.all = false
+		p.partitions = make(map[TopicPartition]bool)
+		p.resumed = make(map[TopicPartition]bool)
+	}
+
+	for _, tp := range partitions {
+		delete(p.partitions, tp)
+
+		if p.all {
+			p.resumed[tp] = true
+		}
+	}
+
+	p.notify()
+}
+
+// paused reports whether the partition is paused, along with a channel that
+// is closed when the paused state changes.
+func (p *pauser) paused(tp TopicPartition) (bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.throttled || p.partitions[tp] || (p.all && !p.resumed[tp]), p.changed
+}
+
+// wait blocks while the partition is paused. It reports false when the done
+// channel is closed first.
+func (p *pauser) wait(tp TopicPartition, done <-chan struct{}) bool {
+	for {
+		paused, changed := p.paused(tp)
+		if !paused {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-done:
+			return false
+		}
+	}
+}
+
+// acquire records a message entering the Consumer, throttling reading once
+// the high-water mark is reached.
+func (p *pauser) acquire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.inflight++
+
+	if p.backpressure.HighWaterMark > 0 && !p.throttled && p.inflight >= p.backpressure.HighWaterMark {
+		p.throttled = true
+		p.log.Warnf("%d messages in flight; pausing consumption", p.inflight)
+		p.notify()
+	}
+}
+
+// release records a message leaving the Consumer, resuming reading once the
+// low-water mark is reached.
+func (p *pauser) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.inflight--
+
+	if p.throttled && p.inflight <= p.backpressure.LowWaterMark {
+		p.throttled = false
+		p.log.Infof("%d messages in flight; resuming consumption", p.inflight)
+		p.notify()
+	}
+}
+
+// notify wakes up the partitions waiting on the paused state; p.mu must be held.
+func (p *pauser) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// describePartitions formats the partitions for logging.
+func describePartitions(partitions []TopicPartition) string {
+	if len(partitions) == 0 {
+		return "all partitions"
+	}
+
+	names := make([]string, len(partitions))
+	for i, tp := range partitions {
+		names[i] = fmt.Sprintf("%s/%d", tp.Topic, tp.Partition)
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPauserPause(t *testing.T) {
+	first, second := TopicPartition{Topic: "events", Partition: 0}, TopicPartition{Topic: "events", Partition: 1}
+
+	tests := []struct {
+		name   string
+		change func(p *pauser)
+		first  bool
+		second bool
+	}{
+		{
+			name:   "none",
+			change: func(p *pauser) {},
+		},
+		{
+			name:   "all",
+			change: func(p *pauser) { p.pause() },
+			first:  true,
+			second: true,
+		},
+		{
+			name:   "partition",
+			change: func(p *pauser) { p.pause(first) },
+			first:  true,
+		},
+		{
+			name:   "resume partition",
+			change: func(p *pauser) { p.pause(first); p.resume(first) },
+		},
+		{
+			name:   "resume all",
+			change: func(p *pauser) { p.pause(first); p.pause(); p.resume() },
+		},
+		{
+			name:   "resume partition of all",
+			change: func(p *pauser) { p.pause(); p.resume(first) },
+			second: true,
+		},
+		{
+			name:   "pause all after resume partition",
+			change: func(p *pauser) { p.pause(); p.resume(first); p.pause() },
+			first:  true,
+			second: true,
+		},
+		{
+			name:   "pause partition after resume partition",
+			change: func(p *pauser) { p.pause(); p.resume(first); p.pause(first) },
+			first:  true,
+			second: true,
+		},
+	}
+
+	for _, tt := range tests {
+		p := newPauser(testLogger(), Backpressure{})
+		tt.change(p)
+
+		if got, _ := p.paused(first); got != tt.first {
+			t.Errorf("%s: paused(%v) = %v, want %v", tt.name, first, got, tt.first)
+		}
+
+		if got, _ := p.paused(second); got != tt.second {
+			t.Errorf("%s: paused(%v) = %v, want %v", tt.name, second, got, tt.second)
+		}
+	}
+}
+
+func TestPauserBackpressure(t *testing.T) {
+	tp := TopicPartition{Topic: "events", Partition: 0}
+	p := newPauser(testLogger(), Backpressure{HighWaterMark: 3, LowWaterMark: 1})
+
+	steps := []struct {
+		change func()
+		paused bool
+	}{
+		{change: p.acquire},
+		{change: p.acquire},
+		{change: p.acquire, paused: true},
+		{change: p.acquire, paused: true},
+		{change: p.release, paused: true},
+		{change: p.release, paused: true},
+		{change: p.release},
+		{change: p.acquire},
+	}
+
+	for i, step := range steps {
+		step.change()
+
+		if got, _ := p.paused(tp); got != step.paused {
+			t.Errorf("step %d: paused() = %v, want %v", i, got, step.paused)
+		}
+	}
+}
+
+func TestPauserWait(t *testing.T) {
+	tp := TopicPartition{Topic: "events", Partition: 0}
+	p := newPauser(testLogger(), Backpressure{})
+	p.pause()
+
+	waited := make(chan bool, 1)
+	done := make(chan struct{})
+
+	go func() { waited <- p.wait(tp, done) }()
+
+	select {
+	case <-waited:
+		t.Fatal("wait() returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.resume(tp)
+
+	select {
+	case got := <-waited:
+		if !got {
+			t.Errorf("wait() = %v after resume, want true", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait() did not return after resume")
+	}
+
+	p.pause(tp)
+
+	go func() { waited <- p.wait(tp, done) }()
+
+	close(done)
+
+	select {
+	case got := <-waited:
+		if got {
+			t.Errorf("wait() = %v after done, want false", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait() did not return after done")
+	}
+}
+
+func TestConsumerPause(t *testing.T) {
+	broker := newConsumerBroker(t, 3)
+	defer broker.Close()
+
+	handled := make(chan int64, 10)
+
+	c := newBrokerConsumer(t, broker, Options{}, func(_ context.Context, msg *Message) error {
+		handled <- msg.Offset
+
+		return nil
+	})
+	defer c.Close()
+
+	c.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = c.Run(ctx) }()
+
+	select {
+	case got := <-handled:
+		t.Fatalf("handled offset %d while paused", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	c.Resume(TopicPartition{Topic: "events", Partition: 0})
+
+	for _, want := range []int64{0, 1, 2} {
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Fatalf("handled offset %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("offset %d not handled after Resume", want)
+		}
+	}
+}
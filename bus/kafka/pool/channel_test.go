@@ -0,0 +1,115 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+type fakeClient struct {
+	closed bool
+}
+
+func (c *fakeClient) SendMessage(*sarama.ProducerMessage) (int32, int64, error) { return 0, 0, nil }
+
+func (c *fakeClient) SendMessages([]*sarama.ProducerMessage) error { return nil }
+
+func (c *fakeClient) Close() error {
+	c.closed = true
+
+	return nil
+}
+
+func newTestPool(t *testing.T, initialCap, maxCap int) (Pool, *int) {
+	t.Helper()
+
+	created := 0
+
+	p, err := NewChannelPool(initialCap, maxCap, func() (sarama.SyncProducer, error) {
+		created++
+
+		return &fakeClient{}, nil
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool() error = %v", err)
+	}
+
+	return p, &created
+}
+
+func TestNewChannelPoolInvalidCapacity(t *testing.T) {
+	factory := func() (sarama.SyncProducer, error) { return &fakeClient{}, nil }
+
+	if _, err := NewChannelPool(2, 1, factory); err == nil {
+		t.Error("NewChannelPool() with initialCap > maxCap succeeded")
+	}
+
+	if _, err := NewChannelPool(0, 0, factory); err == nil {
+		t.Error("NewChannelPool() with a zero maxCap succeeded")
+	}
+}
+
+func TestChannelPoolReuse(t *testing.T) {
+	p, created := newTestPool(t, 1, 2)
+	if p.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", p.Len())
+	}
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	_ = c.Close()
+
+	if _, err = p.Get(); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	if *created != 1 {
+		t.Errorf("created %d client(s), want 1", *created)
+	}
+}
+
+func TestChannelPoolMarkUnusable(t *testing.T) {
+	p, _ := newTestPool(t, 0, 1)
+
+	c, _ := p.Get()
+	p.MarkUnusable(c)
+	_ = c.Close()
+
+	if p.Len() != 0 {
+		t.Errorf("Len() = %d after returning an unusable client, want 0", p.Len())
+	}
+
+	if !c.(*ClientPool).SyncProducer.(*fakeClient).closed {
+		t.Error("unusable client was not closed")
+	}
+}
+
+func TestChannelPoolClosed(t *testing.T) {
+	p, _ := newTestPool(t, 1, 1)
+	p.Close()
+
+	if _, err := p.Get(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Get() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestChannelPoolGetContextDone(t *testing.T) {
+	p, _ := newTestPool(t, 1, 1)
+
+	cp, ok := p.(ContextPool)
+	if !ok {
+		t.Fatalf("NewChannelPool() = %T, want a ContextPool", p)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := cp.GetContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetContext() error = %v, want %v", err, context.Canceled)
+	}
+}
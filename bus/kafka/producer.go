@@ -0,0 +1,303 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"gitscm.cisco.com/mcmp/bus/config"
+	"gitscm.cisco.com/mcmp/bus/errors"
+	"gitscm.cisco.com/mcmp/bus/kafka/pool"
+)
+
+// Record is a message to publish with PublishBatch.
+type Record struct {
+	// ID identifies the message, as the HeaderMessageID header, so consumers
+	// can detect duplicates; a random UUID is used when empty. Set it when the
+	// same message may be published more than once, e.g. when retrying.
+	ID    string
+	Key   string
+	Value []byte
+}
+
+// Receipt describes where a published message was written.
+type Receipt struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	// Timestamp is the timestamp of the message as stored by the broker; the
+	// time it was published, or the time it was appended to the log depending
+	// on the topic configuration.
+	Timestamp time.Time
+}
+
+// newReceipt describes where the published message was written.
+func newReceipt(msg *sarama.ProducerMessage) Receipt {
+	return Receipt{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		// the broker stores timestamps with millisecond precision
+		Timestamp: msg.Timestamp.Truncate(time.Millisecond),
+	}
+}
+
+// PublishError is returned by PublishBatch when only some records failed. The
+// records that are not listed were published.
+type PublishError struct {
+	// Failed maps the index of each failed record in the batch to its error.
+	Failed map[int]error
+}
+
+// Fail records the record at the index of the batch as failed.
+func (e *PublishError) Fail(index int, err error) {
+	if e.Failed == nil {
+		e.Failed = make(map[int]error)
+	}
+
+	e.Failed[index] = err
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("%d message(s) of the batch failed to publish", len(e.Failed))
+}
+
+// Producer provides the details for connecting to Kafka.
+type Producer struct {
+	pool  pool.Pool
+	topic string
+	log   logrus.FieldLogger
+}
+
+// NewProducer creates and configures a new Producer client as a connection pool.
+func NewProducer(opts Options) (*Producer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	// consumer topics are not used by the Producer
+	if opts.Topic == "" {
+		return nil, errors.ConfigurationError("no topic provided")
+	}
+
+	p, err := pool.NewChannelPool(opts.Producer.InitCapacity, opts.Producer.MaxCapacity, makeFactory(opts))
+	if err != nil {
+		opts.Logger.Errorf("error while creating a new channel pool: %v", err)
+
+		return nil, err
+	}
+
+	return &Producer{
+		pool:  p,
+		topic: opts.Topic,
+		log:   opts.Logger,
+	}, nil
+}
+
+func makeFactory(opts Options) pool.Factory {
+	return func() (sarama.SyncProducer, error) {
+		cfg := sarama.NewConfig()
+		cfg.Version = opts.kafkaVersion()
+		cfg.Producer.RequiredAcks = sarama.WaitForAll
+		cfg.Producer.Retry.Max = viper.GetInt(config.ProducerMaxRetry)
+		cfg.Producer.Return.Successes = true
+
+		tlsConfig, err := LoadClientCertificate()
+		if err != nil {
+			opts.Logger.Errorf("error in loading client certificate: %v", err)
+
+			return nil, err
+		}
+
+		if tlsConfig != nil {
+			cfg.Net.TLS.Config = tlsConfig
+			cfg.Net.TLS.Enable = true
+		} else {
+			opts.Logger.Warn("No client certificates provided; connection will be attempted without authentication")
+		}
+
+		return sarama.NewSyncProducer(opts.Hosts, cfg)
+	}
+}
+
+// Publish writes a message on bus.
+func (p *Producer) Publish(key string, msg []byte) error {
+	return p.PublishContext(context.Background(), key, msg)
+}
+
+// PublishContext writes a message on bus, along with the request metadata of the
+// context as message headers. It gives up once the context is done while
+// waiting for a connection from the pool or for the broker to acknowledge the
+// message. The error then wraps both ErrPublishAborted and the context
+// error; the message may still be delivered, as sarama completes sending it in
+// the background.
+func (p *Producer) PublishContext(ctx context.Context, key string, msg []byte) error {
+	_, err := p.PublishWithReceipt(ctx, key, msg)
+
+	return err
+}
+
+// PublishWithReceipt writes a message on bus like PublishContext and returns
+// the Receipt describing where the message was written.
+func (p *Producer) PublishWithReceipt(ctx context.Context, key string, msg []byte) (Receipt, error) {
+	client, err := p.get(ctx)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	pmsg := newProducerMessage(ctx, p.topic, Record{Key: key, Value: msg})
+
+	err = p.send(ctx, client, func(c sarama.SyncProducer) error {
+		_, _, serr := c.SendMessage(pmsg)
+
+		return serr
+	})
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	return newReceipt(pmsg), nil
+}
+
+// PublishBatch writes the records on bus in a single round trip, along with the
+// request metadata of the context as message headers. When only some records
+// failed, the error is a *PublishError listing them so they can be retried;
+// any other error means no record is known to be published. The context is
+// honored like with PublishContext.
+func (p *Producer) PublishBatch(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	client, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	msgs := make([]*sarama.ProducerMessage, len(records))
+	for i, r := range records {
+		msgs[i] = newProducerMessage(ctx, p.topic, r)
+	}
+
+	err = p.send(ctx, client, func(c sarama.SyncProducer) error {
+		return c.SendMessages(msgs)
+	})
+
+	var perrs sarama.ProducerErrors
+	if !stderrors.As(err, &perrs) {
+		return err
+	}
+
+	index := make(map[*sarama.ProducerMessage]int, len(msgs))
+	for i, msg := range msgs {
+		index[msg] = i
+	}
+
+	perr := &PublishError{}
+	for _, e := range perrs {
+		if i, ok := index[e.Msg]; ok {
+			perr.Fail(i, e.Err)
+		}
+	}
+
+	p.log.Errorf("failed to publish %d of %d message(s): %v", len(perr.Failed), len(msgs), err)
+
+	return perr
+}
+
+// get returns a client from the pool, or the error to report. Pools that are
+// not a pool.ContextPool are only checked for the context being done before
+// waiting for a client.
+func (p *Producer) get(ctx context.Context) (sarama.SyncProducer, error) {
+	var (
+		client sarama.SyncProducer
+		err    error
+	)
+
+	if cp, ok := p.pool.(pool.ContextPool); ok {
+		client, err = cp.GetContext(ctx)
+	} else if err = ctx.Err(); err == nil {
+		client, err = p.pool.Get()
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, abortedError{cause: ctx.Err()}
+		}
+
+		p.log.Errorf("failed to get usable connection: %v", err)
+		p.pool.MarkUnusable(client)
+
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// newProducerMessage creates the message writing the record on the topic, with
+// the ID of the record and the request metadata of the context as headers. The
+// timestamp is set so it is known once published; sarama replaces it with the
+// broker timestamp when the topic uses the log append time.
+func newProducerMessage(ctx context.Context, topic string, r Record) *sarama.ProducerMessage {
+	id := r.ID
+	if id == "" {
+		id = newMessageID()
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:     topic,
+		Key:       sarama.StringEncoder(r.Key),
+		Value:     sarama.ByteEncoder(r.Value),
+		Headers:   append([]sarama.RecordHeader{recordHeader(HeaderMessageID, id)}, contextHeaders(ctx)...),
+		Timestamp: time.Now(),
+	}
+}
+
+// newMessageID returns a random (version 4) UUID.
+func newMessageID() string {
+	var b [16]byte
+
+	// crypto/rand.Read never returns an error on the supported platforms
+	_, _ = rand.Read(b[:])
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// send writes messages with the client and returns the client to the pool once
+// sent, returning early when the context is done.
+func (p *Producer) send(ctx context.Context, client sarama.SyncProducer, write func(sarama.SyncProducer) error) error {
+	if ctx.Done() == nil {
+		defer client.Close()
+
+		return write(client)
+	}
+
+	res := make(chan error, 1)
+
+	go func() {
+		defer client.Close()
+
+		res <- write(client)
+	}()
+
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		return abortedError{cause: ctx.Err()}
+	}
+}
+
+// Close will close the connection(s) to the bus.
+func (p *Producer) Close() {
+	p.pool.Close()
+}
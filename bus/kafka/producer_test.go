@@ -0,0 +1,194 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-openapi/strfmt"
+)
+
+// fakeSyncProducer acknowledges messages in memory, failing the messages whose
+// key is listed in fail.
+type fakeSyncProducer struct {
+	mu     sync.Mutex
+	sent   []*sarama.ProducerMessage
+	fail   map[string]error
+	closed int
+}
+
+func (p *fakeSyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if err := p.SendMessages([]*sarama.ProducerMessage{msg}); err != nil {
+		return -1, -1, err.(sarama.ProducerErrors)[0].Err
+	}
+
+	return msg.Partition, msg.Offset, nil
+}
+
+func (p *fakeSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs sarama.ProducerErrors
+
+	for _, msg := range msgs {
+		key, _ := msg.Key.Encode()
+		if err, ok := p.fail[string(key)]; ok {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: err})
+
+			continue
+		}
+
+		msg.Partition, msg.Offset = 1, int64(len(p.sent))
+		p.sent = append(p.sent, msg)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *fakeSyncProducer) Close() error {
+	p.mu.Lock()
+	p.closed++
+	p.mu.Unlock()
+
+	return nil
+}
+
+// fakePool always hands out the same client.
+type fakePool struct {
+	client   sarama.SyncProducer
+	err      error
+	unusable int
+}
+
+func (p *fakePool) Get() (sarama.SyncProducer, error) {
+	return p.client, p.err
+}
+
+func (p *fakePool) MarkUnusable(sarama.SyncProducer) { p.unusable++ }
+
+func (p *fakePool) Close() {}
+
+func (p *fakePool) Len() int { return 1 }
+
+// fakeContextPool is a fakePool that records the contexts it was asked for a
+// client with.
+type fakeContextPool struct {
+	fakePool
+	contexts int
+}
+
+func (p *fakeContextPool) GetContext(ctx context.Context) (sarama.SyncProducer, error) {
+	p.contexts++
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return p.Get()
+}
+
+func newTestProducer(client sarama.SyncProducer) *Producer {
+	return &Producer{pool: &fakePool{client: client}, topic: "events", log: testLogger()}
+}
+
+func TestPublishWithReceipt(t *testing.T) {
+	client := &fakeSyncProducer{}
+	p := newTestProducer(client)
+
+	before := time.Now().Truncate(time.Millisecond)
+
+	r, err := p.PublishWithReceipt(context.Background(), "vm.created", []byte("{}"))
+	if err != nil {
+		t.Fatalf("PublishWithReceipt() error = %v", err)
+	}
+
+	if r.Topic != "events" || r.Partition != 1 || r.Offset != 0 || r.Timestamp.Before(before) {
+		t.Errorf("PublishWithReceipt() = %+v", r)
+	}
+
+	if client.closed != 1 {
+		t.Errorf("client returned to the pool %d time(s), want 1", client.closed)
+	}
+}
+
+func TestPublishBatchPartialFailure(t *testing.T) {
+	failure := errors.New("failure")
+	p := newTestProducer(&fakeSyncProducer{fail: map[string]error{"b": failure}})
+
+	err := p.PublishBatch(context.Background(), []Record{{Key: "a"}, {Key: "b"}, {Key: "c"}})
+
+	var perr *PublishError
+	if !errors.As(err, &perr) {
+		t.Fatalf("PublishBatch() error = %v, want a *PublishError", err)
+	}
+
+	if len(perr.Failed) != 1 || !errors.Is(perr.Failed[1], failure) {
+		t.Errorf("Failed = %v, want only record 1", perr.Failed)
+	}
+}
+
+func TestPublishContextAborted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := newTestProducer(&fakeSyncProducer{}).PublishContext(ctx, "vm.created", nil)
+	if !errors.Is(err, ErrPublishAborted) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("PublishContext() error = %v, want %v and %v", err, ErrPublishAborted, context.Canceled)
+	}
+}
+
+func TestPublishContextPool(t *testing.T) {
+	cp := &fakeContextPool{fakePool: fakePool{client: &fakeSyncProducer{}}}
+	p := &Producer{pool: cp, topic: "events", log: testLogger()}
+
+	if err := p.PublishContext(context.Background(), "vm.created", nil); err != nil {
+		t.Fatalf("PublishContext() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := p.PublishContext(ctx, "vm.created", nil)
+	if !errors.Is(err, ErrPublishAborted) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("PublishContext() error = %v, want %v and %v", err, ErrPublishAborted, context.Canceled)
+	}
+
+	if cp.contexts != 2 {
+		t.Errorf("GetContext() called %d time(s), want 2", cp.contexts)
+	}
+
+	if cp.unusable != 0 {
+		t.Errorf("MarkUnusable() called %d time(s), want 0", cp.unusable)
+	}
+}
+
+func TestNewProducerMessageID(t *testing.T) {
+	messageID := func(msg *sarama.ProducerMessage) string {
+		for _, h := range msg.Headers {
+			if string(h.Key) == HeaderMessageID {
+				return string(h.Value)
+			}
+		}
+
+		return ""
+	}
+
+	first := messageID(newProducerMessage(context.Background(), "events", Record{Key: "vm.created"}))
+	second := messageID(newProducerMessage(context.Background(), "events", Record{Key: "vm.created"}))
+
+	if !strfmt.IsUUID4(first) || first == second {
+		t.Errorf("generated IDs %q and %q, want distinct UUIDs", first, second)
+	}
+
+	if id := messageID(newProducerMessage(context.Background(), "events", Record{ID: "order-42"})); id != "order-42" {
+		t.Errorf("ID = %q, want order-42", id)
+	}
+}
@@ -0,0 +1,103 @@
+package kafka
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+const (
+	defaultRecoveryInitialBackoff = time.Second
+	defaultRecoveryMaxBackoff     = time.Minute
+	recoveryJitter                = 0.2
+)
+
+// OffsetReset defines what a Consumer does when the offset it reads a
+// partition from is no longer available, e.g. because the messages were
+// deleted by the retention policy.
+type OffsetReset int
+
+const (
+	// ResetOldest reads the partition from the oldest message retained.
+	ResetOldest OffsetReset = iota
+	// ResetNewest reads the partition from the next message published.
+	ResetNewest
+	// ResetFail stops reading the partition and reports a *ConsumerError
+	// wrapping sarama.ErrOffsetOutOfRange.
+	ResetFail
+)
+
+// ParseOffsetReset converts the value "oldest", "newest" or "fail" into an
+// OffsetReset. An empty value is the same as "oldest".
+func ParseOffsetReset(val string) (OffsetReset, error) {
+	switch strings.ToLower(strings.TrimSpace(val)) {
+	case "", "oldest":
+		return ResetOldest, nil
+	case "newest":
+		return ResetNewest, nil
+	case "fail":
+		return ResetFail, nil
+	default:
+		return ResetOldest, errors.ConfigurationError("invalid offset reset: " + val)
+	}
+}
+
+// offset returns the sarama offset to read from, reporting false when the
+// partition must not be read.
+func (r OffsetReset) offset() (int64, bool) {
+	switch r {
+	case ResetNewest:
+		return sarama.OffsetNewest, true
+	case ResetFail:
+		return 0, false
+	default:
+		return sarama.OffsetOldest, true
+	}
+}
+
+func (r OffsetReset) String() string {
+	switch r {
+	case ResetNewest:
+		return "newest"
+	case ResetFail:
+		return "fail"
+	default:
+		return "oldest"
+	}
+}
+
+// RecoveryPolicy defines how a Consumer recovers a partition whose stream
+// stopped, e.g. after a broker disconnect or an out of range offset. The
+// partition is re-created from the offset following the last message read,
+// waiting between attempts for a delay growing exponentially from
+// InitialBackoff up to MaxBackoff.
+type RecoveryPolicy struct {
+	// InitialBackoff defaults to one second.
+	InitialBackoff time.Duration
+	// MaxBackoff defaults to one minute.
+	MaxBackoff time.Duration
+	// OffsetReset is applied when the offset to read from is out of range.
+	OffsetReset OffsetReset
+}
+
+// backoff returns the delay before the given attempt to re-create a partition.
+func (p RecoveryPolicy) backoff(attempt int) time.Duration {
+	r := RetryPolicy{
+		InitialBackoff: p.InitialBackoff,
+		MaxBackoff:     p.MaxBackoff,
+		Jitter:         recoveryJitter,
+	}
+
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = defaultRecoveryInitialBackoff
+	}
+
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = defaultRecoveryMaxBackoff
+	}
+
+	return r.backoff(attempt)
+}
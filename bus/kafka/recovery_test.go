@@ -0,0 +1,157 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestRecoveryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RecoveryPolicy
+		attempt int
+		max     time.Duration
+	}{
+		{name: "default first", attempt: 1, max: time.Second},
+		{name: "default capped", attempt: 10, max: time.Minute},
+		{name: "first", policy: RecoveryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, attempt: 1, max: 100 * time.Millisecond},
+		{name: "grown", policy: RecoveryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, attempt: 3, max: 400 * time.Millisecond},
+		{name: "capped", policy: RecoveryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, attempt: 6, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		min := tt.max - time.Duration(float64(tt.max)*recoveryJitter)
+
+		if got := tt.policy.backoff(tt.attempt); got < min || got > tt.max {
+			t.Errorf("%s: backoff(%d) = %s, want between %s and %s", tt.name, tt.attempt, got, min, tt.max)
+		}
+	}
+}
+
+func TestConsumerRecover(t *testing.T) {
+	first := sarama.NewMockFetchResponse(t, 1).SetVersion(4).
+		SetHighWaterMark("events", 0, 3).
+		SetMessage("events", 0, 0, sarama.StringEncoder("{}"))
+
+	outOfRange := &sarama.FetchResponse{Version: 4}
+	outOfRange.AddError("events", 0, sarama.ErrOffsetOutOfRange)
+
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	responses := consumerResponses(t, broker, map[TopicPartition]int{{Topic: "events"}: 3})
+	// the stream stops after the first message, then reads every message
+	responses["FetchRequest"] = sarama.NewMockSequence(first, outOfRange, responses["FetchRequest"])
+	broker.SetHandlerByMap(responses)
+
+	handled := make(chan int64, 10)
+
+	var opts Options
+	opts.Consumer.Recovery.InitialBackoff = 10 * time.Millisecond
+
+	c := newBrokerConsumer(t, broker, opts, func(_ context.Context, msg *Message) error {
+		handled <- msg.Offset
+
+		return nil
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = c.Run(ctx) }()
+
+	// the partition is re-created from the offset following the last message read
+	for _, want := range []int64{0, 1, 2} {
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Fatalf("handled offset %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("offset %d not handled", want)
+		}
+	}
+}
+
+func TestConsumerRecoverOffsetReset(t *testing.T) {
+	const oldest, newest = 5, 8
+
+	tp := TopicPartition{Topic: "events", Partition: 0}
+
+	tests := []struct {
+		reset  OffsetReset
+		offset int64
+		failed bool
+	}{
+		{reset: ResetOldest, offset: oldest},
+		{reset: ResetNewest, offset: newest},
+		{reset: ResetFail, failed: true},
+	}
+
+	for _, tt := range tests {
+		broker := sarama.NewMockBroker(t, 1)
+
+		// the messages before the oldest offset were deleted
+		responses := consumerResponses(t, broker, map[TopicPartition]int{tp: 0})
+		responses["OffsetRequest"] = sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset(tp.Topic, tp.Partition, sarama.OffsetOldest, oldest).
+			SetOffset(tp.Topic, tp.Partition, sarama.OffsetNewest, newest)
+		broker.SetHandlerByMap(responses)
+
+		var (
+			mu       sync.Mutex
+			reported []error
+		)
+
+		var opts Options
+		opts.Consumer.Recovery = RecoveryPolicy{InitialBackoff: time.Millisecond, OffsetReset: tt.reset}
+		opts.Consumer.ErrorHandler = func(err error) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		}
+
+		c := newBrokerConsumer(t, broker, opts, func(context.Context, *Message) error { return nil })
+
+		// the stream stopped at an offset that is no longer retained
+		c.mu.Lock()
+		c.listeners[tp].close()
+		delete(c.listeners, tp)
+		c.resume[tp] = 2
+		c.mu.Unlock()
+
+		c.recover(tp)
+
+		c.mu.Lock()
+		_, consumed := c.listeners[tp]
+		failed := c.failed[tp]
+		c.mu.Unlock()
+
+		if consumed == tt.failed || failed != tt.failed {
+			t.Errorf("%s: partition consumed %v and failed %v, want failed %v", tt.reset, consumed, failed, tt.failed)
+		}
+
+		if lag := c.Lag(); !tt.failed && (len(lag) != 1 || lag[0].Offset != tt.offset) {
+			t.Errorf("%s: Lag() = %+v, want offset %d", tt.reset, lag, tt.offset)
+		}
+
+		var cerr *ConsumerError
+
+		mu.Lock()
+		outOfRange := len(reported) == 1 && errors.As(reported[0], &cerr) && errors.Is(cerr, sarama.ErrOffsetOutOfRange)
+		mu.Unlock()
+
+		if outOfRange != tt.failed {
+			t.Errorf("%s: reported %v, want failure %v", tt.reset, reported, tt.failed)
+		}
+
+		c.Close()
+		broker.Close()
+	}
+}
@@ -0,0 +1,176 @@
+package kafka
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// retryGroupSuffix is appended to the consumer group ID to name the group
+// reading the retry topics.
+const retryGroupSuffix = ".retry"
+
+// retrier reads the retry topics as a member of its own consumer group, holds
+// each message until it is due and dispatches it again. Partitions are read
+// concurrently, so messages waiting on a long delay do not hold back the
+// messages of another retry topic, nor the topics of the Consumer.
+type retrier struct {
+	group      sarama.ConsumerGroup
+	topics     []string
+	dispatcher *dispatcher
+	errors     errorReporter
+	log        logrus.FieldLogger
+}
+
+func newRetrier(opts Options, d *dispatcher, errors errorReporter) (*retrier, error) {
+	config, err := newConsumerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// messages routed to a retry topic before the group first joined are kept
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	groupID := opts.Consumer.GroupID + retryGroupSuffix
+
+	group, err := sarama.NewConsumerGroup(opts.Hosts, groupID, config)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		// closed when the consumer group is closed
+		for gerr := range group.Errors() {
+			errors.report(gerr)
+		}
+	}()
+
+	topics := make([]string, len(opts.Consumer.RetryTiers))
+	for i, tier := range opts.Consumer.RetryTiers {
+		topics[i] = tier.Topic
+	}
+
+	return &retrier{
+		group:      group,
+		topics:     topics,
+		dispatcher: d,
+		errors:     errors,
+		log:        opts.Logger.WithField("group", groupID),
+	}, nil
+}
+
+// start reads the retry topics until the context is cancelled or the retrier is
+// closed. Messages are dispatched with the handler context. The returned
+// channel is closed once the retrier stopped; immediately for a nil retrier.
+func (r *retrier) start(ctx, handlerCtx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+
+	if r == nil {
+		close(done)
+
+		return done
+	}
+
+	handler := &retryHandler{retrier: r, handlerCtx: handlerCtx}
+
+	go func() {
+		defer close(done)
+
+		for {
+			if err := r.group.Consume(ctx, r.topics, handler); err != nil {
+				if stderrors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
+
+				r.errors.report(fmt.Errorf("error in retry consumer group session: %w", err))
+
+				select {
+				case <-time.After(groupRetryBackoff):
+				case <-ctx.Done():
+				}
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+
+	return done
+}
+
+func (r *retrier) close() {
+	if err := r.group.Close(); err != nil {
+		r.log.Errorf("error in closing retry consumer group: %v", err)
+	}
+}
+
+// retryHandler handles the group sessions of a retrier for a single run.
+type retryHandler struct {
+	retrier    *retrier
+	handlerCtx context.Context
+}
+
+// Setup is run at the beginning of a new group session, once partitions have been assigned.
+func (h *retryHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.retrier.log.WithField("generation", session.GenerationID()).Infof("retry partitions assigned: %v", session.Claims())
+
+	return nil
+}
+
+// Cleanup is run at the end of a group session, once all ConsumeClaim routines have exited.
+func (h *retryHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	h.retrier.log.WithField("generation", session.GenerationID()).Infof("retry partitions released: %v", session.Claims())
+
+	return nil
+}
+
+// ConsumeClaim dispatches the messages of a retry topic partition one at a time
+// once they are due. Their offsets are marked once completed, so a message whose
+// handling was interrupted, or that could not be routed to the next retry or
+// the dead-letter topic, holds back the committed offset and is redelivered.
+func (h *retryHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	commits := newCommitter(AtLeastOnce, func(offset int64) {
+		session.MarkOffset(claim.Topic(), claim.Partition(), offset, "")
+	})
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			if !h.wait(session.Context(), h.retrier.dispatcher.retryTopics.due(msg)) {
+				return nil
+			}
+
+			commit := commits.receive(msg.Offset)
+			commit(h.retrier.dispatcher.dispatchOne(h.handlerCtx, msg))
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// wait blocks until the due time, reporting false when the context is done first.
+func (h *retryHandler) wait(ctx context.Context, due time.Time) bool {
+	delay := time.Until(due)
+	if delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
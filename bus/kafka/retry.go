@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 10 * time.Second
+	defaultRetryMultiplier     = 2
+)
+
+// RetryPolicy defines how a message is retried when the MessageHandler fails.
+// The delay between attempts grows exponentially from InitialBackoff by
+// Multiplier up to MaxBackoff, and is reduced by a random fraction of up to
+// Jitter to avoid retrying in lock-step.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a message is handled,
+	// including the first attempt. Zero or one disables retries.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is a fraction between 0 and 1.
+	Jitter float64
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before the next attempt, given the number of
+// attempts already made.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial, maxBackoff, multiplier := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+
+	if initial <= 0 {
+		initial = defaultRetryInitialBackoff
+	}
+
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	if multiplier < 1 {
+		multiplier = defaultRetryMultiplier
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if delay > float64(maxBackoff) {
+		delay = float64(maxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		//nolint:gosec // jitter does not require a cryptographically secure random number
+		delay -= delay * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+
+	return time.Duration(delay)
+}
+
+// wait blocks for the backoff of the given attempt or until the context is done.
+func (p RetryPolicy) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(p.backoff(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+
+	for attempt, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+	} {
+		if got := p.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 500*time.Millisecond || got > time.Second {
+			t.Fatalf("backoff(1) = %s, want between 500ms and 1s", got)
+		}
+	}
+}
+
+func TestRetryPolicyAttempts(t *testing.T) {
+	if got := (RetryPolicy{}).attempts(); got != 1 {
+		t.Errorf("attempts() = %d, want 1", got)
+	}
+
+	if got := (RetryPolicy{MaxAttempts: 3}).attempts(); got != 3 {
+		t.Errorf("attempts() = %d, want 3", got)
+	}
+}
+
+func TestRetryPolicyWaitCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := RetryPolicy{InitialBackoff: time.Hour}.wait(ctx, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait() error = %v, want %v", err, context.Canceled)
+	}
+}
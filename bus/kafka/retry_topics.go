@@ -0,0 +1,212 @@
+package kafka
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+// Headers added to a message routed to a retry topic.
+const (
+	// HeaderRetryAttempt contains the number of the retry topic the message was
+	// routed to, starting at 1.
+	HeaderRetryAttempt = "bus-retry-attempt"
+	// HeaderRetryDue contains the time the message is redelivered (RFC3339Nano).
+	HeaderRetryDue = "bus-retry-due"
+	// HeaderRetryError contains the error returned by the last attempt.
+	HeaderRetryError = "bus-retry-error"
+	// HeaderRetryTopic contains the topic the message was originally consumed from.
+	HeaderRetryTopic = "bus-retry-source-topic"
+	// HeaderRetryPartition contains the partition the message was originally consumed from.
+	HeaderRetryPartition = "bus-retry-source-partition"
+	// HeaderRetryOffset contains the offset the message was originally consumed from.
+	HeaderRetryOffset = "bus-retry-source-offset"
+)
+
+// RetryTier is a topic holding failed messages until they are redelivered,
+// Delay after they failed.
+type RetryTier struct {
+	Topic string
+	Delay time.Duration
+}
+
+// ParseRetryTiers converts a comma separated list of topic=delay pairs, such as
+// "orders-retry-10s=10s,orders-retry-1m=1m", into RetryTiers.
+func ParseRetryTiers(val string) ([]RetryTier, error) {
+	tiers := make([]RetryTier, 0)
+
+	for _, item := range strings.Split(val, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.ConfigurationError("invalid retry topic: " + item)
+		}
+
+		delay, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, errors.ConfigurationError("invalid retry topic delay: " + item)
+		}
+
+		tiers = append(tiers, RetryTier{Topic: strings.TrimSpace(parts[0]), Delay: delay})
+	}
+
+	return tiers, nil
+}
+
+// retryTopics routes failed messages to the next retry topic.
+type retryTopics struct {
+	tiers    []RetryTier
+	producer sarama.SyncProducer
+	log      logrus.FieldLogger
+}
+
+func newRetryTopics(opts Options) (*retryTopics, error) {
+	producer, err := makeFactory(opts)()
+	if err != nil {
+		return nil, err
+	}
+
+	return &retryTopics{
+		tiers:    opts.Consumer.RetryTiers,
+		producer: producer,
+		log:      opts.Logger,
+	}, nil
+}
+
+// next returns the index of the retry topic a message consumed from the topic
+// is routed to, reporting false once every retry topic was used.
+func (rt *retryTopics) next(topic string) (int, bool) {
+	next := 0
+
+	for i, tier := range rt.tiers {
+		if tier.Topic == topic {
+			next = i + 1
+		}
+	}
+
+	return next, next < len(rt.tiers)
+}
+
+// delay returns the delay of the retry topic, reporting false for any other topic.
+func (rt *retryTopics) delay(topic string) (time.Duration, bool) {
+	for _, tier := range rt.tiers {
+		if tier.Topic == topic {
+			return tier.Delay, true
+		}
+	}
+
+	return 0, false
+}
+
+// publish writes the message to the retry topic keeping its original key, value
+// and headers, and replaces the headers describing the retry. The topic,
+// partition and offset the message was originally consumed from are carried
+// through every retry topic.
+func (rt *retryTopics) publish(msg *sarama.ConsumerMessage, tier int, cause error) error {
+	src := origin(msg)
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+6)
+
+	for _, h := range msg.Headers {
+		if h != nil && !bytes.HasPrefix(h.Key, []byte("bus-retry-")) {
+			headers = append(headers, *h)
+		}
+	}
+
+	due := time.Now().Add(rt.tiers[tier].Delay)
+
+	headers = append(headers,
+		recordHeader(HeaderRetryAttempt, strconv.Itoa(tier+1)),
+		recordHeader(HeaderRetryDue, due.UTC().Format(time.RFC3339Nano)),
+		recordHeader(HeaderRetryError, cause.Error()),
+		recordHeader(HeaderRetryTopic, src.topic),
+		recordHeader(HeaderRetryPartition, strconv.FormatInt(int64(src.partition), 10)),
+		recordHeader(HeaderRetryOffset, strconv.FormatInt(src.offset, 10)),
+	)
+
+	_, _, err := rt.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   rt.tiers[tier].Topic,
+		Key:     sarama.ByteEncoder(msg.Key),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	rt.log.Warnf("message with key %s from %s routed to retry topic %s, due at %s",
+		msg.Key, src, rt.tiers[tier].Topic, due.Format(time.RFC3339Nano))
+
+	return nil
+}
+
+// due returns the time a message consumed from a retry topic is redelivered.
+func (rt *retryTopics) due(msg *sarama.ConsumerMessage) time.Time {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == HeaderRetryDue {
+			if t, err := time.Parse(time.RFC3339Nano, string(h.Value)); err == nil {
+				return t
+			}
+		}
+	}
+
+	// fall back to the time the message was published
+	delay, _ := rt.delay(msg.Topic)
+
+	return msg.Timestamp.Add(delay)
+}
+
+// source identifies where a message was originally consumed from.
+type source struct {
+	topic     string
+	partition int32
+	offset    int64
+}
+
+func (s source) String() string {
+	return fmt.Sprintf("%s/%d/%d", s.topic, s.partition, s.offset)
+}
+
+// origin returns where the message was originally consumed from: as recorded
+// in the headers of a message redelivered from a retry topic, or where it was
+// consumed from otherwise.
+func origin(msg *sarama.ConsumerMessage) source {
+	src := source{topic: msg.Topic, partition: msg.Partition, offset: msg.Offset}
+
+	for _, h := range msg.Headers {
+		if h == nil {
+			continue
+		}
+
+		switch string(h.Key) {
+		case HeaderRetryTopic:
+			src.topic = string(h.Value)
+		case HeaderRetryPartition:
+			if p, err := strconv.ParseInt(string(h.Value), 10, 32); err == nil {
+				src.partition = int32(p)
+			}
+		case HeaderRetryOffset:
+			if o, err := strconv.ParseInt(string(h.Value), 10, 64); err == nil {
+				src.offset = o
+			}
+		}
+	}
+
+	return src
+}
+
+func (rt *retryTopics) close() {
+	if err := rt.producer.Close(); err != nil {
+		rt.log.Errorf("error in closing retry producer: %v", err)
+	}
+}
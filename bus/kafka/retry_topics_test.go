@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestParseRetryTiers(t *testing.T) {
+	got, err := ParseRetryTiers(" orders-retry-10s=10s, ,orders-retry-1m = 1m")
+	if err != nil {
+		t.Fatalf("ParseRetryTiers() error = %v", err)
+	}
+
+	want := []RetryTier{{Topic: "orders-retry-10s", Delay: 10 * time.Second}, {Topic: "orders-retry-1m", Delay: time.Minute}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRetryTiers() = %v, want %v", got, want)
+	}
+
+	for _, val := range []string{"orders-retry", "orders-retry=soon"} {
+		if _, err = ParseRetryTiers(val); err == nil {
+			t.Errorf("ParseRetryTiers(%q) succeeded", val)
+		}
+	}
+}
+
+// consumed returns the message as consumed from the topic it was produced to.
+func consumed(msg *sarama.ProducerMessage, partition int32, offset int64) *sarama.ConsumerMessage {
+	key, _ := msg.Key.Encode()
+	value, _ := msg.Value.Encode()
+
+	return &sarama.ConsumerMessage{
+		Topic:     msg.Topic,
+		Partition: partition,
+		Offset:    offset,
+		Key:       key,
+		Value:     value,
+		Headers:   recordHeaders(msg.Headers),
+	}
+}
+
+func header(msg *sarama.ProducerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
+
+func TestRetryTopicsKeepOrigin(t *testing.T) {
+	producer := &fakeSyncProducer{}
+	rt := &retryTopics{
+		tiers:    []RetryTier{{Topic: "orders-retry-1"}, {Topic: "orders-retry-2"}},
+		producer: producer,
+		log:      testLogger(),
+	}
+	dl := &deadLetter{topic: "orders-dlq", producer: producer, log: testLogger()}
+	failure := errors.New("failure")
+
+	msg := &sarama.ConsumerMessage{Topic: "orders", Partition: 3, Offset: 7, Key: []byte("order.created")}
+
+	for tier := range rt.tiers {
+		if err := rt.publish(msg, tier, failure); err != nil {
+			t.Fatalf("publish() to tier %d error = %v", tier, err)
+		}
+
+		msg = consumed(producer.sent[len(producer.sent)-1], 0, int64(tier))
+
+		if m := newMessage(msg); m.Topic != "orders" || m.Partition != 3 || m.Offset != 7 {
+			t.Errorf("message from %s located at %s/%d/%d, want orders/3/7", msg.Topic, m.Topic, m.Partition, m.Offset)
+		}
+	}
+
+	if err := dl.publish(msg, 1, failure); err != nil {
+		t.Fatalf("publish() to the dead-letter topic error = %v", err)
+	}
+
+	dead := producer.sent[len(producer.sent)-1]
+	for key, want := range map[string]string{
+		HeaderDeadLetterTopic:     "orders",
+		HeaderDeadLetterPartition: "3",
+		HeaderDeadLetterOffset:    "7",
+		HeaderRetryAttempt:        "2",
+	} {
+		if got := header(dead, key); got != want {
+			t.Errorf("header %s = %q, want %q", key, got, want)
+		}
+	}
+}
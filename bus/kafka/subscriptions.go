@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"gitscm.cisco.com/ccdev/go-common/sets"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+// SubscribeAll is the event pattern that subscribes to every message key.
+const SubscribeAll = "*"
+
+// subscriptions holds the events a Consumer is subscribed to. An event is either
+// an exact message key (e.g. "vm.created") or a glob pattern as supported by
+// path.Match (e.g. "vm.*"). SubscribeAll matches every key. Subscriptions can be
+// changed safely while the Consumer is running.
+type subscriptions struct {
+	mu       sync.RWMutex
+	exact    sets.String
+	patterns sets.String
+}
+
+func newSubscriptions(events ...string) (*subscriptions, error) {
+	s := &subscriptions{
+		exact:    sets.NewString(),
+		patterns: sets.NewString(),
+	}
+
+	if err := s.add(events...); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// add subscribes to the events; no event is added if any pattern is invalid.
+func (s *subscriptions) add(events ...string) error {
+	for _, event := range events {
+		if isPattern(event) {
+			if _, err := path.Match(event, ""); err != nil {
+				return errors.ConfigurationError("invalid event pattern: " + event)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		if isPattern(event) {
+			s.patterns.Insert(event)
+		} else {
+			s.exact.Insert(event)
+		}
+	}
+
+	return nil
+}
+
+// remove unsubscribes from the events, which must match the value used to subscribe.
+func (s *subscriptions) remove(events ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.exact.Delete(events...)
+	s.patterns.Delete(events...)
+}
+
+// has reports whether the key matches any subscribed event.
+func (s *subscriptions) has(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.exact.Has(key) || s.patterns.Has(SubscribeAll) {
+		return true
+	}
+
+	for pattern := range s.patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPattern(event string) bool {
+	return strings.ContainsAny(event, `*?[\`)
+}
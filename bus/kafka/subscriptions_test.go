@@ -0,0 +1,47 @@
+package kafka
+
+import "testing"
+
+func TestSubscriptions(t *testing.T) {
+	s, err := newSubscriptions("vm.created", "host.*")
+	if err != nil {
+		t.Fatalf("newSubscriptions() error = %v", err)
+	}
+
+	for key, want := range map[string]bool{
+		"vm.created":   true,
+		"vm.deleted":   false,
+		"host.created": true,
+		"hostname":     false,
+	} {
+		if got := s.has(key); got != want {
+			t.Errorf("has(%q) = %v, want %v", key, got, want)
+		}
+	}
+
+	s.remove("host.*")
+
+	if s.has("host.created") {
+		t.Error("has(host.created) after removing the pattern")
+	}
+
+	if err := s.add(SubscribeAll); err != nil {
+		t.Fatalf("add(%q) error = %v", SubscribeAll, err)
+	}
+
+	if !s.has("anything") {
+		t.Error("has(anything) is false when subscribed to all")
+	}
+}
+
+func TestSubscriptionsInvalidPattern(t *testing.T) {
+	s, _ := newSubscriptions()
+
+	if err := s.add("vm.created", "vm.["); err == nil {
+		t.Fatal("add() with an invalid pattern succeeded")
+	}
+
+	if s.has("vm.created") {
+		t.Error("event added along with an invalid pattern")
+	}
+}
@@ -0,0 +1,86 @@
+package kafka
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/Shopify/sarama"
+
+	"gitscm.cisco.com/mcmp/bus/errors"
+)
+
+// TopicPartition identifies a partition of a topic.
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// topicSet resolves the topics read by a Consumer: the configured topics and
+// the topics whose name matches the topic pattern.
+type topicSet struct {
+	topics  []string
+	pattern *regexp.Regexp
+}
+
+// newTopicSet creates the topicSet for the consumer options. The Topic is
+// used when neither Consumer.Topics nor Consumer.TopicPattern is provided.
+func newTopicSet(opts Options) (topicSet, error) {
+	t := topicSet{topics: opts.Consumer.Topics}
+
+	if opts.Consumer.TopicPattern != "" {
+		pattern, err := regexp.Compile(opts.Consumer.TopicPattern)
+		if err != nil {
+			return t, errors.ConfigurationError("invalid topic pattern: " + opts.Consumer.TopicPattern)
+		}
+
+		t.pattern = pattern
+	}
+
+	if len(t.topics) == 0 && t.pattern == nil {
+		t.topics = []string{opts.Topic}
+	}
+
+	return t, nil
+}
+
+// resolve returns the sorted topics to read; topics matching the pattern are
+// taken from the metadata known by the client.
+func (t topicSet) resolve(client sarama.Client) ([]string, error) {
+	topics := make(map[string]bool, len(t.topics))
+
+	for _, topic := range t.topics {
+		topics[topic] = true
+	}
+
+	if t.pattern != nil {
+		all, err := client.Topics()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, topic := range all {
+			if t.pattern.MatchString(topic) {
+				topics[topic] = true
+			}
+		}
+	}
+
+	list := make([]string, 0, len(topics))
+	for topic := range topics {
+		list = append(list, topic)
+	}
+
+	sort.Strings(list)
+
+	return list, nil
+}
+
+// refresh refreshes the metadata of the topics, or of every topic when a
+// pattern is used so that new matching topics are discovered.
+func (t topicSet) refresh(client sarama.Client) error {
+	if t.pattern != nil {
+		return client.RefreshMetadata()
+	}
+
+	return client.RefreshMetadata(t.topics...)
+}
@@ -0,0 +1,72 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestConsumerTopics(t *testing.T) {
+	events, logs := TopicPartition{Topic: "events", Partition: 0}, TopicPartition{Topic: "logs", Partition: 0}
+	ignored := TopicPartition{Topic: "audit", Partition: 0}
+
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(consumerResponses(t, broker, map[TopicPartition]int{events: 1, logs: 2, ignored: 1}))
+
+	handled := make(chan TopicPartition, 10)
+
+	var opts Options
+	opts.Consumer.Topics = []string{"events", "logs"}
+
+	c := newBrokerConsumer(t, broker, opts, partitionRecorder(handled))
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = c.Run(ctx) }()
+
+	// the handler is told which topic each message was read from
+	expectPartitions(t, handled, map[TopicPartition]int{events: 1, logs: 2})
+}
+
+func TestConsumerTopicPattern(t *testing.T) {
+	events, logs := TopicPartition{Topic: "vm.events", Partition: 0}, TopicPartition{Topic: "vm.logs", Partition: 0}
+	ignored := TopicPartition{Topic: "audit", Partition: 0}
+
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(consumerResponses(t, broker, map[TopicPartition]int{events: 1, ignored: 1}))
+
+	handled := make(chan TopicPartition, 10)
+
+	var opts Options
+	opts.Consumer.TopicPattern = `^vm\.`
+	opts.Consumer.RefreshFrequency = 50 * time.Millisecond
+
+	c := newBrokerConsumer(t, broker, opts, partitionRecorder(handled))
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = c.Run(ctx) }()
+
+	expectPartitions(t, handled, map[TopicPartition]int{events: 1})
+
+	// a matching topic created later is discovered by the refresh
+	broker.SetHandlerByMap(consumerResponses(t, broker, map[TopicPartition]int{events: 1, logs: 2, ignored: 1}))
+
+	expectPartitions(t, handled, map[TopicPartition]int{logs: 2})
+
+	select {
+	case tp := <-handled:
+		t.Errorf("handled a message of %v, which does not match the pattern", tp)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HandlerTimeout defines the time budget of a handler for each attempt.
+type HandlerTimeout struct {
+	// Timeout is the deadline of the context passed to the handler. Handlers
+	// are not limited when zero.
+	Timeout time.Duration
+	// Abandon reports the attempt as failed with ErrHandlerTimeout once the
+	// timeout expired, without waiting for the handler to return, so the
+	// Consumer moves on. The handler keeps running in the background until it
+	// returns. When false, the Consumer waits for the handler to return.
+	Abandon bool
+}
+
+// watchdog enforces the HandlerTimeout and reports the handlers that exceeded it.
+type watchdog struct {
+	HandlerTimeout
+	log logrus.FieldLogger
+	// exceeded counts the handlers that exceeded the timeout.
+	exceeded int64
+}
+
+// invoke calls the handler with a context bound by the timeout. subject
+// describes what is handled for logging.
+func (w *watchdog) invoke(ctx context.Context, subject string, call func(context.Context) error) error {
+	if w.Timeout <= 0 {
+		return call(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+
+	go func() {
+		done <- call(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	if !stderrors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// the Consumer is stopping; the handler is given the shutdown timeout
+		return <-done
+	}
+
+	atomic.AddInt64(&w.exceeded, 1)
+
+	if w.Abandon {
+		w.log.Errorf("handler for %s exceeded its timeout of %s; abandoning it", subject, w.Timeout)
+
+		return fmt.Errorf("%w: %s", ErrHandlerTimeout, w.Timeout)
+	}
+
+	w.log.Warnf("handler for %s exceeded its timeout of %s", subject, w.Timeout)
+
+	err := <-done
+	w.log.Warnf("handler for %s returned after %s", subject, time.Since(start))
+
+	return err
+}
+
+// count returns the number of handlers that exceeded the timeout.
+func (w *watchdog) count() int64 {
+	return atomic.LoadInt64(&w.exceeded)
+}
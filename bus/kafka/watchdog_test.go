@@ -0,0 +1,174 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestWatchdogInvoke(t *testing.T) {
+	failure := errors.New("failure")
+
+	tests := []struct {
+		name     string
+		timeout  HandlerTimeout
+		duration time.Duration
+		err      error
+		exceeded int64
+	}{
+		{
+			name:     "no timeout",
+			duration: 50 * time.Millisecond,
+			err:      failure,
+		},
+		{
+			name:     "within timeout",
+			timeout:  HandlerTimeout{Timeout: time.Second},
+			duration: 10 * time.Millisecond,
+			err:      failure,
+		},
+		{
+			name:     "exceeded",
+			timeout:  HandlerTimeout{Timeout: 20 * time.Millisecond},
+			duration: 100 * time.Millisecond,
+			err:      failure,
+			exceeded: 1,
+		},
+		{
+			name:     "abandoned",
+			timeout:  HandlerTimeout{Timeout: 20 * time.Millisecond, Abandon: true},
+			duration: 100 * time.Millisecond,
+			err:      ErrHandlerTimeout,
+			exceeded: 1,
+		},
+		{
+			name:     "abandon within timeout",
+			timeout:  HandlerTimeout{Timeout: time.Second, Abandon: true},
+			duration: 10 * time.Millisecond,
+			err:      failure,
+		},
+	}
+
+	for _, tt := range tests {
+		w := &watchdog{HandlerTimeout: tt.timeout, log: testLogger()}
+		duration := tt.duration
+
+		// the handler ignores the deadline of its context
+		err := w.invoke(context.Background(), "vm.created", func(context.Context) error {
+			time.Sleep(duration)
+
+			return failure
+		})
+
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: invoke() error = %v, want %v", tt.name, err, tt.err)
+		}
+
+		if got := w.count(); got != tt.exceeded {
+			t.Errorf("%s: count() = %d, want %d", tt.name, got, tt.exceeded)
+		}
+	}
+}
+
+func TestWatchdogAbandon(t *testing.T) {
+	w := &watchdog{HandlerTimeout: HandlerTimeout{Timeout: 20 * time.Millisecond, Abandon: true}, log: testLogger()}
+
+	release, returned := make(chan struct{}), make(chan struct{})
+	invoked := make(chan error, 1)
+
+	go func() {
+		invoked <- w.invoke(context.Background(), "vm.created", func(ctx context.Context) error {
+			<-ctx.Done()
+			<-release
+			close(returned)
+
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-invoked:
+		if !errors.Is(err, ErrHandlerTimeout) {
+			t.Errorf("invoke() error = %v, want %v", err, ErrHandlerTimeout)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("invoke() did not abandon the handler")
+	}
+
+	// the abandoned handler keeps running until it returns
+	select {
+	case <-returned:
+		t.Error("handler returned before it was released")
+	default:
+	}
+
+	close(release)
+	<-returned
+}
+
+func TestWatchdogInterrupted(t *testing.T) {
+	w := &watchdog{HandlerTimeout: HandlerTimeout{Timeout: time.Second, Abandon: true}, log: testLogger()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// a handler cancelled by the Consumer stopping is waited for
+	err := w.invoke(ctx, "vm.created", func(context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Errorf("invoke() error = %v, want nil", err)
+	}
+
+	if got := w.count(); got != 0 {
+		t.Errorf("count() = %d, want 0", got)
+	}
+}
+
+func TestConsumerHandlerTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	handled := make(chan string, 2)
+
+	var opts Options
+	opts.Consumer.HandlerTimeout = HandlerTimeout{Timeout: 50 * time.Millisecond, Abandon: true}
+
+	c := newTestConsumer(t, opts, func(_ context.Context, msg *Message) error {
+		if msg.Key == "vm.created" {
+			<-release
+		}
+
+		handled <- msg.Key
+
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = c.Run(ctx) }()
+
+	c.messages <- &sarama.ConsumerMessage{Topic: "events", Key: []byte("vm.created")}
+	c.messages <- &sarama.ConsumerMessage{Topic: "events", Key: []byte("vm.deleted"), Offset: 1}
+
+	// the single worker moves on once the blocked handler is abandoned
+	select {
+	case got := <-handled:
+		if got != "vm.deleted" {
+			t.Errorf("handled %s, want vm.deleted", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message following the blocked one not handled")
+	}
+
+	if got := c.HandlerTimeouts(); got != 1 {
+		t.Errorf("HandlerTimeouts() = %d, want 1", got)
+	}
+}
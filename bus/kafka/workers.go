@@ -0,0 +1,190 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// defaultQueueSize is the number of messages each worker can hold before
+// submitting more messages blocks.
+const defaultQueueSize = 100
+
+// job is a message waiting to be dispatched by a worker.
+type job struct {
+	// ctx is passed to the handler.
+	ctx context.Context
+	msg *sarama.ConsumerMessage
+	// skip is closed once messages that were not started yet must be dropped,
+	// e.g. when the Consumer is stopping.
+	skip <-chan struct{}
+	// done is called once the job was either dispatched or skipped, reporting
+	// whether the message was completed; a skipped message is not.
+	done func(completed bool)
+}
+
+// workerPool dispatches messages concurrently. Messages are assigned to a worker
+// by key so messages with the same key are handled in order, while messages
+// with different keys are handled in parallel. Each worker has a bounded
+// queue, so submitting blocks once the queue of the worker is full.
+type workerPool struct {
+	dispatcher *dispatcher
+	queues     []chan job
+	wg         sync.WaitGroup
+}
+
+// newWorkerPool creates and starts a workerPool with at least one worker, so
+// messages are never handled by the caller, which keeps reading and stopping
+// while a handler is running.
+func newWorkerPool(d *dispatcher, workers, queueSize int) *workerPool {
+	p := &workerPool{dispatcher: d}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	p.queues = make([]chan job, workers)
+
+	for i := range p.queues {
+		p.queues[i] = make(chan job, queueSize)
+
+		p.wg.Add(1)
+
+		go p.work(p.queues[i])
+	}
+
+	return p
+}
+
+func (p *workerPool) work(queue <-chan job) {
+	defer p.wg.Done()
+
+	if p.dispatcher.batchHandler != nil {
+		p.workBatches(queue)
+
+		return
+	}
+
+	for j := range queue {
+		p.run(j)
+	}
+}
+
+// workBatches collects the jobs of the queue into batches of up to the maximum
+// size, delivering a partial batch once the maximum wait elapsed since its
+// first job was received.
+func (p *workerPool) workBatches(queue <-chan job) {
+	maxSize, maxWait := p.dispatcher.batch.maxSize(), p.dispatcher.batch.maxWait()
+
+	for j := range queue {
+		batch := []job{j}
+		timer := time.NewTimer(maxWait)
+		open := true
+
+		var next job
+
+	Collect:
+		for open && len(batch) < maxSize {
+			select {
+			case next, open = <-queue:
+				if open {
+					batch = append(batch, next)
+				}
+			case <-timer.C:
+				break Collect
+			}
+		}
+
+		timer.Stop()
+		p.runBatch(batch)
+
+		if !open {
+			return
+		}
+	}
+}
+
+// runBatch dispatches the jobs that are not skipped as batches, one for each
+// consecutive run of jobs sharing the same context, so a batch never mixes
+// messages whose handling may be cancelled independently.
+func (p *workerPool) runBatch(jobs []job) {
+	ready := make([]job, 0, len(jobs))
+
+	for _, j := range jobs {
+		select {
+		case <-j.skip:
+			if j.done != nil {
+				j.done(false)
+			}
+		default:
+			ready = append(ready, j)
+		}
+	}
+
+	for start := 0; start < len(ready); {
+		end := start + 1
+		for end < len(ready) && ready[end].ctx == ready[start].ctx {
+			end++
+		}
+
+		msgs := make([]*sarama.ConsumerMessage, end-start)
+		for i, j := range ready[start:end] {
+			msgs[i] = j.msg
+		}
+
+		handled := p.dispatcher.dispatchBatch(ready[start].ctx, msgs)
+
+		for i, j := range ready[start:end] {
+			if j.done != nil {
+				j.done(handled[i])
+			}
+		}
+
+		start = end
+	}
+}
+
+func (p *workerPool) run(j job) {
+	done := false
+
+	select {
+	case <-j.skip:
+	default:
+		done = p.dispatcher.dispatch(j.ctx, j.msg) == nil
+	}
+
+	if j.done != nil {
+		j.done(done)
+	}
+}
+
+// submit queues the job on the worker assigned to the message key. It blocks
+// while the queue is full and returns the context error if the context is done
+// first, in which case the job is dropped without calling done.
+func (p *workerPool) submit(ctx context.Context, j job) error {
+	h := fnv.New32a()
+	_, _ = h.Write(j.msg.Key)
+
+	select {
+	case p.queues[h.Sum32()%uint32(len(p.queues))] <- j:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop stops accepting messages and waits for the queued jobs to complete.
+func (p *workerPool) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+
+	p.wg.Wait()
+}
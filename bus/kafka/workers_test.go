@@ -0,0 +1,72 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func newTestDispatcher(t *testing.T, opts Options, tg target) *dispatcher {
+	t.Helper()
+
+	if opts.Logger == nil {
+		opts.Logger = testLogger()
+	}
+
+	d, err := newDispatcher(opts, tg, SubscribeAll)
+	if err != nil {
+		t.Fatalf("newDispatcher() error = %v", err)
+	}
+
+	return d
+}
+
+func TestWorkerPoolCompletion(t *testing.T) {
+	failure := errors.New("failure")
+	d := newTestDispatcher(t, Options{}, target{handler: func(_ context.Context, msg *Message) error {
+		if msg.Key == "vm.deleted" {
+			return nil
+		}
+
+		return failure
+	}})
+	p := newWorkerPool(d, 1, 0)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	skipped := make(chan struct{})
+	close(skipped)
+
+	tests := []struct {
+		name string
+		job  job
+		want bool
+	}{
+		{name: "handled", job: job{ctx: context.Background(), msg: &sarama.ConsumerMessage{Key: []byte("vm.deleted")}}, want: true},
+		{name: "failed", job: job{ctx: context.Background()}, want: false},
+		{name: "interrupted", job: job{ctx: cancelled}, want: false},
+		{name: "skipped", job: job{ctx: context.Background(), skip: skipped}, want: false},
+	}
+
+	for _, tt := range tests {
+		done := make(chan bool, 1)
+
+		if tt.job.msg == nil {
+			tt.job.msg = &sarama.ConsumerMessage{Key: []byte("vm.created")}
+		}
+		tt.job.done = func(completed bool) { done <- completed }
+
+		if err := p.submit(context.Background(), tt.job); err != nil {
+			t.Fatalf("%s: submit() error = %v", tt.name, err)
+		}
+
+		if got := <-done; got != tt.want {
+			t.Errorf("%s: done called with %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	p.stop()
+}
@@ -0,0 +1,128 @@
+package bus
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"gitscm.cisco.com/mcmp/bus/config"
+	"gitscm.cisco.com/mcmp/bus/kafka"
+)
+
+// defaultRetryJitter is the fraction of each retry backoff that is randomized.
+const defaultRetryJitter = 0.2
+
+// Options provides the available configurations for Consumers and Producers.
+type Options struct {
+	kafka.Options
+}
+
+// DefaultOptions creates an instance of Options with default values for each
+// of the Options attibutes.
+func DefaultOptions() Options {
+	opts := Options{}
+	opts.Logger = defaultLogger()
+	opts.Hosts = cleanList(viper.GetString(config.BusHosts))
+	opts.Topic = viper.GetString(config.BusTopicEvent)
+
+	version, err := kafka.ParseKafkaVersion(viper.GetString(config.BusKafkaVersion))
+	if err != nil {
+		opts.Logger.Errorf("ignoring kafka version: %v", err)
+	}
+
+	opts.Version = version
+	opts.Producer.InitCapacity = viper.GetInt(config.ProducerInitCap)
+	opts.Producer.MaxCapacity = viper.GetInt(config.ProducerMaxCap)
+	opts.Producer.BufferSize = viper.GetInt(config.ProducerBufferSize)
+	opts.Producer.FlushTimeout = viper.GetDuration(config.ProducerFlushTimeout)
+	opts.Consumer.GroupID = viper.GetString(config.ConsumerGroupID)
+	opts.Consumer.Topics = cleanList(viper.GetString(config.ConsumerTopics))
+	opts.Consumer.TopicPattern = viper.GetString(config.ConsumerTopicPattern)
+	opts.Consumer.RefreshFrequency = viper.GetDuration(config.ConsumerRefreshFrequency)
+
+	start, err := kafka.ParseStartPosition(viper.GetString(config.ConsumerStart))
+	if err != nil {
+		opts.Logger.Errorf("ignoring consumer start position: %v", err)
+	}
+
+	opts.Consumer.Start = start
+	opts.Consumer.Recovery.InitialBackoff = viper.GetDuration(config.ConsumerRecoveryInitialBackoff)
+	opts.Consumer.Recovery.MaxBackoff = viper.GetDuration(config.ConsumerRecoveryMaxBackoff)
+
+	reset, err := kafka.ParseOffsetReset(viper.GetString(config.ConsumerOffsetReset))
+	if err != nil {
+		opts.Logger.Errorf("ignoring consumer offset reset: %v", err)
+	}
+
+	opts.Consumer.Recovery.OffsetReset = reset
+	opts.Consumer.HandlerTimeout.Timeout = viper.GetDuration(config.ConsumerHandlerTimeout)
+	opts.Consumer.HandlerTimeout.Abandon = viper.GetBool(config.ConsumerHandlerAbandon)
+	opts.Consumer.Middleware = []kafka.Middleware{kafka.Recover(opts.Logger)}
+	opts.Consumer.BatchMiddleware = []kafka.BatchMiddleware{kafka.RecoverBatch(opts.Logger)}
+	opts.Consumer.Retry.MaxAttempts = viper.GetInt(config.ConsumerRetryMaxAttempts)
+	opts.Consumer.Retry.InitialBackoff = viper.GetDuration(config.ConsumerRetryInitialBackoff)
+	opts.Consumer.Retry.MaxBackoff = viper.GetDuration(config.ConsumerRetryMaxBackoff)
+	opts.Consumer.Retry.Jitter = defaultRetryJitter
+
+	tiers, err := kafka.ParseRetryTiers(viper.GetString(config.ConsumerRetryTopics))
+	if err != nil {
+		opts.Logger.Errorf("ignoring consumer retry topics: %v", err)
+	}
+
+	opts.Consumer.RetryTiers = tiers
+	opts.Consumer.DeadLetterTopic = viper.GetString(config.ConsumerDeadLetterTopic)
+
+	if size := viper.GetInt(config.ConsumerDedupSize); size > 0 {
+		opts.Consumer.Dedup.Store = kafka.NewMemoryDedupStore(size, viper.GetDuration(config.ConsumerDedupTTL))
+	}
+
+	opts.Consumer.Workers = viper.GetInt(config.ConsumerWorkers)
+	opts.Consumer.QueueSize = viper.GetInt(config.ConsumerQueueSize)
+	opts.Consumer.ShutdownTimeout = viper.GetDuration(config.ConsumerShutdownTimeout)
+	opts.Consumer.CommitInterval = viper.GetDuration(config.ConsumerCommitInterval)
+	opts.Consumer.LagInterval = viper.GetDuration(config.ConsumerLagInterval)
+	opts.Consumer.Batch.MaxSize = viper.GetInt(config.ConsumerBatchSize)
+	opts.Consumer.Batch.MaxWait = viper.GetDuration(config.ConsumerBatchWait)
+	opts.Consumer.Backpressure.HighWaterMark = viper.GetInt(config.ConsumerBackpressureHigh)
+	opts.Consumer.Backpressure.LowWaterMark = viper.GetInt(config.ConsumerBackpressureLow)
+
+	delivery, err := kafka.ParseDeliveryMode(viper.GetString(config.ConsumerDelivery))
+	if err != nil {
+		opts.Logger.Errorf("ignoring consumer delivery mode: %v", err)
+	}
+
+	opts.Consumer.Delivery = delivery
+
+	return opts
+}
+
+// Validate verifies the values provided for Options are valid.
+func (o Options) Validate() error {
+	return o.Options.Validate()
+}
+
+func defaultLogger() logrus.FieldLogger {
+	l := logrus.New()
+	// configure the default logger to include timestamps and quote empty fields
+	// to make visually seeing an empty Field easier.
+	l.Formatter = &logrus.TextFormatter{
+		FullTimestamp:    true,
+		QuoteEmptyFields: true,
+	}
+	l.SetLevel(logrus.ErrorLevel)
+
+	return l
+}
+
+func cleanList(val string) []string {
+	items := make([]string, 0)
+
+	for _, item := range strings.Split(val, ",") {
+		if i := strings.TrimSpace(item); i != "" {
+			items = append(items, i)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,95 @@
+package bus
+
+import (
+	"context"
+
+	"gitscm.cisco.com/mcmp/bus/kafka"
+)
+
+// ErrPublishAborted is wrapped, along with the context error, by the error
+// returned when the context of a publish is done before the message was
+// acknowledged.
+var ErrPublishAborted = kafka.ErrPublishAborted
+
+// Receipt describes where a published message was written.
+type Receipt = kafka.Receipt
+
+// Record is a message to publish with PublishBatch.
+type Record = kafka.Record
+
+// PublishError is returned by PublishBatch when only some records failed.
+type PublishError = kafka.PublishError
+
+// Producer defines a minimal interface for an Message Bus Producer.
+//
+// The Producers created by this package also implement ContextPublisher,
+// ReceiptPublisher and BatchPublisher, which callers may assert.
+type Producer interface {
+	// Publish writes a named event and message to the Message Bus.
+	Publish(string, []byte) error
+	// Close releases any resources in use.
+	Close()
+}
+
+// ContextPublisher is implemented by a Producer that publishes the request
+// metadata of a context.
+type ContextPublisher interface {
+	// PublishContext writes a named event and message to the Message Bus,
+	// along with the request metadata of the context as message headers,
+	// giving up once the context is done.
+	PublishContext(context.Context, string, []byte) error
+}
+
+// ReceiptPublisher is implemented by a Producer that reports where a message
+// was written.
+type ReceiptPublisher interface {
+	// PublishWithReceipt writes a named event and message to the Message Bus
+	// like PublishContext, and returns the topic, partition, offset and
+	// timestamp the message was written with.
+	PublishWithReceipt(context.Context, string, []byte) (Receipt, error)
+}
+
+// BatchPublisher is implemented by a Producer that publishes several messages
+// at once.
+type BatchPublisher interface {
+	// PublishBatch writes the records to the Message Bus in a single round
+	// trip. When only some records failed, the error is a *PublishError
+	// listing them so only those are retried.
+	PublishBatch(context.Context, []Record) error
+}
+
+// DeliveryCallback is invoked once a message published asynchronously was
+// acknowledged, with the Receipt, or failed, with the error.
+type DeliveryCallback = kafka.DeliveryCallback
+
+var (
+	// ErrProducerClosed is returned when publishing with a closed AsyncProducer.
+	ErrProducerClosed = kafka.ErrProducerClosed
+	// ErrFlushTimeout is reported for the messages left unsent once the flush
+	// timeout of a closing AsyncProducer expired.
+	ErrFlushTimeout = kafka.ErrFlushTimeout
+)
+
+// AsyncProducer defines a minimal interface for a Message Bus Producer that
+// publishes messages in the background.
+type AsyncProducer interface {
+	// PublishAsync queues a named event and message to be written to the
+	// Message Bus and returns without waiting for it to be acknowledged. The
+	// callback, when not nil, is invoked with the outcome. It blocks while the
+	// buffer is full, giving up once the context is done.
+	PublishAsync(context.Context, string, []byte, DeliveryCallback) error
+	// Close stops accepting messages and waits up to the flush timeout for
+	// pending messages to be sent, returning an error wrapping ErrFlushTimeout
+	// when some were left unsent.
+	Close() error
+}
+
+// NewProducer creates and configures a Producer.
+func NewProducer(opts Options) (Producer, error) {
+	return kafka.NewProducer(opts.Options)
+}
+
+// NewAsyncProducer creates and configures an AsyncProducer.
+func NewAsyncProducer(opts Options) (AsyncProducer, error) {
+	return kafka.NewAsyncPublisher(opts.Options)
+}
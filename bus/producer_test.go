@@ -0,0 +1,23 @@
+package bus
+
+import (
+	"testing"
+
+	"gitscm.cisco.com/mcmp/bus/kafka"
+)
+
+// producerCapabilities lists every interface the Producers of this package implement.
+type producerCapabilities interface {
+	Producer
+	ContextPublisher
+	ReceiptPublisher
+	BatchPublisher
+}
+
+func TestProducerCapabilities(t *testing.T) {
+	var p Producer = &kafka.Producer{}
+
+	if _, ok := p.(producerCapabilities); !ok {
+		t.Errorf("%T does not implement every producer capability", p)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/swapandeepsur/msk_poc
 go 1.19
 
 require (
+	github.com/sirupsen/logrus v1.8.1
 	gitscm.cisco.com/mcmp/bus v0.4.0
 	gitscm.cisco.com/mcmp/utils v0.12.0
 )
@@ -29,7 +30,6 @@ require (
 	github.com/pelletier/go-toml v1.9.4 // indirect
 	github.com/pierrec/lz4 v2.5.2+incompatible // indirect
 	github.com/rcrowley/go-metrics v0.0.0-20200313005456-10cdbea86bc0 // indirect
-	github.com/sirupsen/logrus v1.8.1 // indirect
 	github.com/spf13/afero v1.6.0 // indirect
 	github.com/spf13/cast v1.4.1 // indirect
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
@@ -49,3 +49,5 @@ require (
 	gopkg.in/jcmturner/rpc.v1 v1.1.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
+
+replace gitscm.cisco.com/mcmp/bus => ./bus